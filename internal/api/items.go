@@ -0,0 +1,160 @@
+package api
+
+import (
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+// Item is the JSON representation of an UrlItem, its metadata does not list
+// the available formats
+type Item struct {
+	ID          string            `json:"id"`
+	Url         string            `json:"url"`
+	Title       string            `json:"title"`
+	Stage       url.DownloadStage `json:"stage"`
+	Profile     string            `json:"profile,omitempty"`
+	Options     []string          `json:"options,omitempty"`
+	Format      url.FormatChoice  `json:"format"`
+	Group       *url.Group        `json:"group,omitempty"`
+	Metadata    *url.Metadata     `json:"metadata,omitempty"`
+	LogFile     string            `json:"log_file,omitempty"`
+	StartedAt   *time.Time        `json:"started_at,omitempty"`
+	StoppedAt   *time.Time        `json:"stopped_at,omitempty"`
+	Progress    *Progress         `json:"progress,omitempty"`
+	Failure     *url.Failure      `json:"failure,omitempty"`
+	Attempts    int               `json:"attempts,omitempty"`
+	NextRetryAt *time.Time        `json:"next_retry_at,omitempty"`
+}
+
+// Progress is the JSON representation of url.Progress, the speed is in bytes
+// per second and the eta in seconds
+type Progress struct {
+	Status          string    `json:"status"`
+	Percent         float64   `json:"percent"`
+	DownloadedBytes int64     `json:"downloaded_bytes"`
+	TotalBytes      int64     `json:"total_bytes,omitempty"`
+	Speed           float64   `json:"speed,omitempty"`
+	ETA             float64   `json:"eta,omitempty"`
+	FragmentIndex   int       `json:"fragment_index,omitempty"`
+	FragmentCount   int       `json:"fragment_count,omitempty"`
+	Filename        string    `json:"filename,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// LogLine is the JSON representation of url.LogLine
+type LogLine struct {
+	Seq    uint64     `json:"seq"`
+	At     time.Time  `json:"at"`
+	Stream url.Stream `json:"stream"`
+	Text   string     `json:"text"`
+}
+
+func NewItem(item *url.UrlItem) Item {
+	result := Item{
+		ID:          item.ID(),
+		Url:         item.Url,
+		Title:       item.Title(),
+		Stage:       item.Stage(),
+		Profile:     item.Profile.Name,
+		Options:     item.Options,
+		Format:      item.Format(),
+		LogFile:     item.LogFile(),
+		StartedAt:   optionalTime(item.StartedAt()),
+		StoppedAt:   optionalTime(item.StoppedAt()),
+		Failure:     item.Failure(),
+		Attempts:    item.Attempts(),
+		NextRetryAt: optionalTime(item.NextRetryAt()),
+	}
+	if item.Group.Url != "" {
+		group := item.Group
+		result.Group = &group
+	}
+	result.Metadata = item.Metadata().Summary()
+	if progress := item.Progress(); progress.Known() {
+		converted := NewProgress(progress)
+		result.Progress = &converted
+	}
+	return result
+}
+
+// State returns the state of the item as saved by its owner
+func (i Item) State() url.ItemState {
+	state := url.ItemState{
+		ID:       i.ID,
+		Url:      i.Url,
+		Stage:    i.Stage,
+		Profile:  i.Profile,
+		Options:  i.Options,
+		Failure:  i.Failure,
+		Attempts: i.Attempts,
+		LogFile:  i.LogFile,
+		Metadata: i.Metadata,
+		Format:   i.Format,
+		Group:    i.Group,
+	}
+	if i.StartedAt != nil {
+		state.StartedAt = *i.StartedAt
+	}
+	if i.StoppedAt != nil {
+		state.StoppedAt = *i.StoppedAt
+	}
+	if i.NextRetryAt != nil {
+		state.NextRetryAt = *i.NextRetryAt
+	}
+	if i.Progress != nil {
+		state.OutputPath = i.Progress.Filename
+	}
+	return state
+}
+
+// DownloadProgress returns the progress of the item, unknown until yt-dlp
+// reported some
+func (i Item) DownloadProgress() url.Progress {
+	if i.Progress == nil {
+		return url.Progress{}
+	}
+	return url.Progress{
+		Status:          i.Progress.Status,
+		Percent:         i.Progress.Percent,
+		DownloadedBytes: i.Progress.DownloadedBytes,
+		TotalBytes:      i.Progress.TotalBytes,
+		Speed:           i.Progress.Speed,
+		ETA:             time.Duration(i.Progress.ETA * float64(time.Second)),
+		FragmentIndex:   i.Progress.FragmentIndex,
+		FragmentCount:   i.Progress.FragmentCount,
+		Filename:        i.Progress.Filename,
+		UpdatedAt:       i.Progress.UpdatedAt,
+	}
+}
+
+func NewProgress(p url.Progress) Progress {
+	return Progress{
+		Status:          p.Status,
+		Percent:         p.Percent,
+		DownloadedBytes: p.DownloadedBytes,
+		TotalBytes:      p.TotalBytes,
+		Speed:           p.Speed,
+		ETA:             p.ETA.Seconds(),
+		FragmentIndex:   p.FragmentIndex,
+		FragmentCount:   p.FragmentCount,
+		Filename:        p.Filename,
+		UpdatedAt:       p.UpdatedAt,
+	}
+}
+
+func NewLogLine(line url.LogLine) LogLine {
+	return LogLine{Seq: line.Seq, At: line.At, Stream: line.Stream, Text: line.Text}
+}
+
+// Line returns the line as recorded by url.LogBuffer
+func (l LogLine) Line() url.LogLine {
+	return url.LogLine{Seq: l.Seq, At: l.At, Stream: l.Stream, Text: l.Text}
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
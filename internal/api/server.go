@@ -0,0 +1,447 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+// maxBodySize bounds the size of request bodies
+const maxBodySize = 1 << 20
+
+// Server exposes the items of a queue as a JSON API. Every request must carry
+// the token as "Authorization: Bearer <token>", the event stream also takes
+// it as ?token= for the EventSource clients which cannot set headers.
+type Server struct {
+	queue    *url.Queue
+	config   config.Config
+	executor url.CommandExecutor
+	token    string
+	mux      *http.ServeMux
+	stream   *stream
+	// unsubscribe stops feeding the stream with the events of the queue
+	unsubscribe func()
+}
+
+// NewServer returns a server adding items to queue with cfg, running yt-dlp
+// through executor
+func NewServer(queue *url.Queue, cfg config.Config, executor url.CommandExecutor) *Server {
+	s := &Server{
+		queue:    queue,
+		config:   cfg,
+		executor: executor,
+		token:    cfg.API.Token,
+		mux:      http.NewServeMux(),
+		stream:   newStream(),
+	}
+
+	// the ids of the stream must not skip over dropped events
+	events, unsubscribe := queue.Events().SubscribeLossless()
+	s.unsubscribe = unsubscribe
+	go s.stream.run(events)
+
+	s.mux.HandleFunc("GET /api/items", s.listItems)
+	s.mux.HandleFunc("POST /api/items", s.addItems)
+	s.mux.HandleFunc("GET /api/items/{id}", s.withItem(s.getItem))
+	s.mux.HandleFunc("DELETE /api/items/{id}", s.withItem(s.removeItem))
+	s.mux.HandleFunc("POST /api/items/{id}/pause", s.withItem(s.pauseItem))
+	s.mux.HandleFunc("POST /api/items/{id}/resume", s.withItem(s.resumeItem))
+	s.mux.HandleFunc("POST /api/items/{id}/retry", s.withItem(s.retryItem))
+	s.mux.HandleFunc("GET /api/items/{id}/logs", s.withItem(s.itemLogs))
+	s.mux.HandleFunc("PUT /api/items/{id}/format", s.withItem(s.setFormat))
+	s.mux.HandleFunc("POST /api/items/{id}/move", s.withItem(s.moveItem))
+	s.mux.HandleFunc("GET /api/queue", s.getQueue)
+	s.mux.HandleFunc("PUT /api/queue", s.updateQueue)
+	s.mux.HandleFunc("POST /api/queue/clear", s.clearQueue)
+	s.mux.HandleFunc("POST /api/queue/sort", s.sortQueue)
+	s.mux.HandleFunc("GET /api/events", s.streamEvents)
+
+	return s
+}
+
+// Close ends the event streams and stops following the queue
+func (s *Server) Close() {
+	s.unsubscribe()
+}
+
+// Listen serves the API on addr in the background until the returned server
+// is shut down, an address that cannot be listened on is reported right away
+func (s *Server) Listen(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return s.serve(listener, s), nil
+}
+
+// ListenUnix serves the API on a unix socket at path which only the user can
+// connect to, requests on it do not need the token. A socket left by a
+// process which exited is replaced.
+func (s *Server) ListenUnix(path string) (*http.Server, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s is in use by another process", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	// the socket must not be reachable by other users, even briefly
+	mask := syscall.Umask(0o077)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(mask)
+	if err != nil {
+		return nil, err
+	}
+	return s.serve(listener, s.mux), nil
+}
+
+func (s *Server) serve(listener net.Listener, handler http.Handler) *http.Server {
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	// event streams never become idle, they must end for Shutdown to return
+	server.RegisterOnShutdown(s.Close)
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println(err)
+		}
+	}()
+	return server
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	// only the event stream takes the token from the query, which ends up in
+	// access logs and browser history
+	if !ok && r.Method == http.MethodGet && r.URL.Path == "/api/events" {
+		token, ok = r.URL.Query().Get("token"), r.URL.Query().Has("token")
+	}
+	return ok && s.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// withItem resolves the {id} of the path to an item of the queue
+func (s *Server) withItem(handler func(http.ResponseWriter, *http.Request, *url.UrlItem)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		item := s.queue.Get(r.PathValue("id"))
+		if item == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no item with id %q", r.PathValue("id")))
+			return
+		}
+		handler(w, r, item)
+	}
+}
+
+func (s *Server) listItems(w http.ResponseWriter, r *http.Request) {
+	items := s.queue.Items()
+	result := make([]Item, 0, len(items))
+	for _, item := range items {
+		result = append(result, NewItem(item))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// AddRequest is the body of POST /api/items, the urls are added with the
+// named profile or the first one of the config. Items are added as they are,
+// even when already listed, and keep their format, group and metadata.
+type AddRequest struct {
+	Urls    []string  `json:"urls,omitempty"`
+	Profile string    `json:"profile,omitempty"`
+	Items   []AddItem `json:"items,omitempty"`
+}
+
+// AddItem describes an item of AddRequest, such as one prepared in the add
+// form of a client. It holds no yt-dlp arguments, which could run commands
+// through --exec, the profiles of the config choose them.
+type AddItem struct {
+	Url      string           `json:"url"`
+	Profile  string           `json:"profile,omitempty"`
+	Format   url.FormatChoice `json:"format"`
+	Group    *url.Group       `json:"group,omitempty"`
+	Metadata *url.Metadata    `json:"metadata,omitempty"`
+}
+
+// AddResponse lists the items created by POST /api/items and the urls which
+// were skipped, because they are invalid or already in the list
+type AddResponse struct {
+	Items   []Item    `json:"items"`
+	Skipped []Skipped `json:"skipped,omitempty"`
+}
+
+type Skipped struct {
+	Url   string `json:"url"`
+	Error string `json:"error"`
+}
+
+func (s *Server) addItems(w http.ResponseWriter, r *http.Request) {
+	var request AddRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	if len(request.Urls) == 0 && len(request.Items) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no urls to add"))
+		return
+	}
+
+	profile, err := s.profile(request.Profile)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	entries := make([]url.BatchEntry, 0, len(request.Urls))
+	for idx, rawUrl := range request.Urls {
+		entries = append(entries, url.BatchEntry{Line: idx + 1, Url: rawUrl})
+	}
+	items, errs := s.queue.BatchItems(entries, s.config, profile, s.executor)
+
+	var response AddResponse
+	for _, err := range errs {
+		var batchErr *url.BatchError
+		if errors.As(err, &batchErr) {
+			response.Skipped = append(response.Skipped, Skipped{Url: batchErr.Entry.Url, Error: batchErr.Err.Error()})
+		}
+	}
+	for _, spec := range request.Items {
+		item, err := s.newItem(spec)
+		if err != nil {
+			response.Skipped = append(response.Skipped, Skipped{Url: spec.Url, Error: err.Error()})
+			continue
+		}
+		items = append(items, item)
+	}
+	s.queue.Add(items...)
+
+	response.Items = make([]Item, 0, len(items))
+	for _, item := range items {
+		response.Items = append(response.Items, NewItem(item))
+	}
+
+	status := http.StatusCreated
+	if len(items) == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, response)
+}
+
+// profile returns the profile with the given name, or the first one of the
+// config when name is empty
+func (s *Server) profile(name string) (config.Profile, error) {
+	if name != "" {
+		profile, ok := s.config.Profile(name)
+		if !ok {
+			return profile, fmt.Errorf("unknown profile %q", name)
+		}
+		return profile, nil
+	}
+	if len(s.config.Profiles) > 0 {
+		return s.config.Profiles[0], nil
+	}
+	return config.Profile{}, nil
+}
+
+// newItem creates the item described by spec
+func (s *Server) newItem(spec AddItem) (*url.UrlItem, error) {
+	cleaned, err := url.Clean(spec.Url)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := s.profile(spec.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	item := url.NewUrlItemEx(cleaned, s.executor)
+	if err := item.ApplyConfig(s.config, profile); err != nil {
+		return nil, err
+	}
+	item.SetFormat(spec.Format)
+	if spec.Group != nil {
+		item.Group = *spec.Group
+	}
+	if spec.Metadata != nil {
+		item.SetMetadata(spec.Metadata)
+	}
+	return item, nil
+}
+
+func (s *Server) getItem(w http.ResponseWriter, r *http.Request, item *url.UrlItem) {
+	writeJSON(w, http.StatusOK, NewItem(item))
+}
+
+func (s *Server) removeItem(w http.ResponseWriter, r *http.Request, item *url.UrlItem) {
+	s.queue.Remove(item)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) pauseItem(w http.ResponseWriter, r *http.Request, item *url.UrlItem) {
+	s.stageAction(w, item, s.queue.Pause, "queued or downloading")
+}
+
+func (s *Server) resumeItem(w http.ResponseWriter, r *http.Request, item *url.UrlItem) {
+	s.stageAction(w, item, s.queue.Resume, "paused")
+}
+
+func (s *Server) retryItem(w http.ResponseWriter, r *http.Request, item *url.UrlItem) {
+	s.stageAction(w, item, s.queue.Retry, "failed")
+}
+
+// stageAction applies action to item, answering 409 Conflict when the item
+// is not in one of the expected stages
+func (s *Server) stageAction(w http.ResponseWriter, item *url.UrlItem, action func(*url.UrlItem) bool, expected string) {
+	if !action(item) {
+		writeError(w, http.StatusConflict, fmt.Errorf("item %s is %s, not %s", item.ID(), item.Stage(), expected))
+		return
+	}
+	writeJSON(w, http.StatusOK, NewItem(item))
+}
+
+// setFormat picks the formats of an item which is not running
+func (s *Server) setFormat(w http.ResponseWriter, r *http.Request, item *url.UrlItem) {
+	var choice url.FormatChoice
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&choice); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	if item.Stage().Running() {
+		writeError(w, http.StatusConflict, fmt.Errorf("item %s is %s", item.ID(), item.Stage()))
+		return
+	}
+
+	s.queue.SetFormat(item, choice)
+	writeJSON(w, http.StatusOK, NewItem(item))
+}
+
+// MoveRequest is the body of POST /api/items/{id}/move
+type MoveRequest struct {
+	Delta int `json:"delta"`
+}
+
+// moveItem shifts a queued item among the queued items
+func (s *Server) moveItem(w http.ResponseWriter, r *http.Request, item *url.UrlItem) {
+	var request MoveRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	s.queue.Move(item, request.Delta)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// QueueInfo describes the queue, only Concurrency can be changed
+type QueueInfo struct {
+	Concurrency int `json:"concurrency"`
+	Running     int `json:"running"`
+	Items       int `json:"items"`
+}
+
+func (s *Server) queueInfo() QueueInfo {
+	return QueueInfo{
+		Concurrency: s.queue.Concurrency(),
+		Running:     s.queue.Running(),
+		Items:       s.queue.Len(),
+	}
+}
+
+func (s *Server) getQueue(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.queueInfo())
+}
+
+func (s *Server) updateQueue(w http.ResponseWriter, r *http.Request) {
+	var request QueueInfo
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	if request.Concurrency < 1 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("concurrency must be at least 1, got %d", request.Concurrency))
+		return
+	}
+
+	s.queue.SetConcurrency(request.Concurrency)
+	writeJSON(w, http.StatusOK, s.queueInfo())
+}
+
+// clearQueue removes the completed and archived items
+func (s *Server) clearQueue(w http.ResponseWriter, r *http.Request) {
+	s.queue.RemoveCompleted()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sortQueue moves the completed items to the end of the list
+func (s *Server) sortQueue(w http.ResponseWriter, r *http.Request) {
+	s.queue.SortByComplete()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogsResponse is the output of an item, Dropped counts the lines evicted
+// from the buffer which can only be read from the log file
+type LogsResponse struct {
+	Lines   []LogLine `json:"lines"`
+	Dropped uint64    `json:"dropped"`
+	LogFile string    `json:"log_file,omitempty"`
+}
+
+// itemLogs returns the output of the item, only the lines after the sequence
+// number given as ?since= when set
+func (s *Server) itemLogs(w http.ResponseWriter, r *http.Request, item *url.UrlItem) {
+	var since uint64
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		if since, err = strconv.ParseUint(value, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid since: %w", err))
+			return
+		}
+	}
+
+	logs := item.Logs()
+	lines := logs.Since(since)
+	response := LogsResponse{
+		Lines:   make([]LogLine, 0, len(lines)),
+		Dropped: logs.Dropped(),
+		LogFile: item.LogFile(),
+	}
+	for _, line := range lines {
+		response.Lines = append(response.Lines, NewLogLine(line))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Println(err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
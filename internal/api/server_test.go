@@ -0,0 +1,367 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/testutil"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+const testToken = "secret"
+
+// testOutput is printed by the mock downloads of the tests
+const testOutput = "[info] Downloading\n[download] Destination: video.mp4\n"
+
+func configWithToken() config.Config {
+	cfg := config.Default()
+	cfg.API = config.API{Enabled: true, Listen: "127.0.0.1:0", Token: testToken}
+	return cfg
+}
+
+// newTestServer serves a queue running one download at a time with the
+// mock downloads printing testOutput
+func newTestServer(t *testing.T, wait time.Duration) (*httptest.Server, *url.Queue) {
+	t.Helper()
+
+	queue := url.NewQueue(1)
+	handler := NewServer(queue, configWithToken(), url.NewMockDownloadExecutor(wait, testOutput))
+	server := httptest.NewServer(handler)
+	t.Cleanup(func() {
+		handler.Close()
+		server.Close()
+		queue.StopAll()
+	})
+	return server, queue
+}
+
+// do sends an authenticated request and decodes the JSON response into out
+func do(t *testing.T, server *httptest.Server, method string, path string, body any, out any) int {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	request, err := http.NewRequest(method, server.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer "+testToken)
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if out != nil && response.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return response.StatusCode
+}
+
+func waitForStage(t *testing.T, item *url.UrlItem, stage url.DownloadStage) {
+	t.Helper()
+
+	testutil.WaitFor(t, item.Url+" to reach "+stage.String(), func() bool {
+		return item.Stage() == stage
+	})
+}
+
+func TestServer_Auth(t *testing.T) {
+	server, _ := newTestServer(t, time.Millisecond)
+
+	for _, header := range []string{"", "Bearer wrong", "Basic " + testToken, testToken} {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/api/items", nil)
+		if header != "" {
+			request.Header.Set("Authorization", header)
+		}
+		response, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%q: expected 401, got %d", header, response.StatusCode)
+		}
+	}
+
+	// the query token is only for the event stream
+	response, err := server.Client().Get(server.URL + "/api/items?token=" + testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a query token, got %d", response.StatusCode)
+	}
+
+	var items []Item
+	if status := do(t, server, http.MethodGet, "/api/items", nil, &items); status != http.StatusOK {
+		t.Errorf("Expected 200 with the token, got %d", status)
+	}
+}
+
+func TestServer_AddAndList(t *testing.T) {
+	server, queue := newTestServer(t, time.Second)
+
+	var added AddResponse
+	status := do(t, server, http.MethodPost, "/api/items", AddRequest{
+		Urls:    []string{"https://youtu.be/dQw4w9WgXcQ", "not a url", "https://example.com/clip", "https://example.com/clip/"},
+		Profile: "audio mp3",
+	}, &added)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if len(added.Items) != 2 || len(added.Skipped) != 2 {
+		t.Fatalf("Expected 2 items and 2 skipped urls, got %+v", added)
+	}
+	if added.Items[0].Url != "https://youtu.be/dQw4w9WgXcQ" || added.Items[0].Profile != "audio mp3" {
+		t.Errorf("Expected the url as given with the audio profile, got %+v", added.Items[0])
+	}
+	if added.Skipped[0].Url != "not a url" {
+		t.Errorf("Expected the invalid url to be skipped, got %+v", added.Skipped[0])
+	}
+	if queue.Len() != 2 {
+		t.Errorf("Expected 2 items in the queue, got %d", queue.Len())
+	}
+
+	var items []Item
+	do(t, server, http.MethodGet, "/api/items", nil, &items)
+	if len(items) != 2 || items[1].ID != added.Items[1].ID {
+		t.Errorf("Expected the added items, got %+v", items)
+	}
+
+	var item Item
+	if status := do(t, server, http.MethodGet, "/api/items/"+items[0].ID, nil, &item); status != http.StatusOK {
+		t.Errorf("Expected 200, got %d", status)
+	}
+	if item.Url != items[0].Url {
+		t.Errorf("Expected %s, got %s", items[0].Url, item.Url)
+	}
+
+	var failed map[string]string
+	if status := do(t, server, http.MethodGet, "/api/items/missing", nil, &failed); status != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", status)
+	}
+
+	for _, body := range []any{AddRequest{}, AddRequest{Urls: []string{"https://example.com/a"}, Profile: "missing"}, "urls"} {
+		if status := do(t, server, http.MethodPost, "/api/items", body, &failed); status != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d", body, status)
+		}
+	}
+
+	if status := do(t, server, http.MethodPost, "/api/items", AddRequest{Urls: []string{"https://example.com/clip"}}, &added); status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 when every url is skipped, got %d", status)
+	}
+}
+
+func TestServer_StageActions(t *testing.T) {
+	server, queue := newTestServer(t, time.Second)
+
+	var added AddResponse
+	do(t, server, http.MethodPost, "/api/items", AddRequest{
+		Urls: []string{"https://example.com/first", "https://example.com/second"},
+	}, &added)
+	first, second := queue.Get(added.Items[0].ID), queue.Get(added.Items[1].ID)
+	waitForStage(t, first, url.StageDownloading)
+
+	var item Item
+	if status := do(t, server, http.MethodPost, "/api/items/"+second.ID()+"/pause", nil, &item); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if item.Stage != url.StagePaused {
+		t.Errorf("Expected the queued item to be paused, got %s", item.Stage)
+	}
+
+	var failed map[string]string
+	if status := do(t, server, http.MethodPost, "/api/items/"+second.ID()+"/pause", nil, &failed); status != http.StatusConflict {
+		t.Errorf("Expected 409 pausing a paused item, got %d", status)
+	}
+	if status := do(t, server, http.MethodPost, "/api/items/"+second.ID()+"/retry", nil, &failed); status != http.StatusConflict {
+		t.Errorf("Expected 409 retrying an item which did not fail, got %d", status)
+	}
+
+	if status := do(t, server, http.MethodPost, "/api/items/"+second.ID()+"/resume", nil, &item); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if item.Stage != url.StageQueued {
+		t.Errorf("Expected the item to be queued again, got %s", item.Stage)
+	}
+
+	if status := do(t, server, http.MethodDelete, "/api/items/"+first.ID(), nil, nil); status != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	if queue.Get(first.ID()) != nil {
+		t.Error("Expected the item to be removed")
+	}
+	// the removed item freed its slot
+	waitForStage(t, second, url.StageDownloading)
+}
+
+func TestServer_RetryAndLogs(t *testing.T) {
+	server, queue := newTestServer(t, 10*time.Millisecond)
+
+	var added AddResponse
+	do(t, server, http.MethodPost, "/api/items", AddRequest{
+		Urls: []string{"https://example.com/fail", "https://example.com/video"},
+	}, &added)
+	failing, video := queue.Get(added.Items[0].ID), queue.Get(added.Items[1].ID)
+	waitForStage(t, failing, url.StageError)
+	waitForStage(t, video, url.StageCompleted)
+
+	var item Item
+	if status := do(t, server, http.MethodPost, "/api/items/"+failing.ID()+"/retry", nil, &item); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	waitForStage(t, failing, url.StageError)
+	if failing.Attempts() != 1 {
+		t.Errorf("Expected the attempts to start over, got %d", failing.Attempts())
+	}
+
+	var logs LogsResponse
+	if status := do(t, server, http.MethodGet, "/api/items/"+video.ID()+"/logs", nil, &logs); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if len(logs.Lines) != 2 || logs.Lines[0].Text != "[info] Downloading" || logs.Lines[0].Stream != url.StreamStdout {
+		t.Errorf("Expected the output of the item, got %+v", logs.Lines)
+	}
+
+	do(t, server, http.MethodGet, "/api/items/"+video.ID()+"/logs?since=1", nil, &logs)
+	if len(logs.Lines) != 1 || logs.Lines[0].Seq != 2 {
+		t.Errorf("Expected the lines after the first one, got %+v", logs.Lines)
+	}
+
+	var failed map[string]string
+	if status := do(t, server, http.MethodGet, "/api/items/"+video.ID()+"/logs?since=x", nil, &failed); status != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", status)
+	}
+}
+
+func TestServer_AddItemSpecs(t *testing.T) {
+	server, queue := newTestServer(t, time.Second)
+
+	group := url.Group{Url: "https://example.com/playlist", Title: "Playlist"}
+	spec := AddItem{
+		Url:    "https://example.com/video",
+		Format: url.FormatChoice{Video: "137", Audio: "140"},
+		Group:  &group,
+	}
+
+	var added AddResponse
+	if status := do(t, server, http.MethodPost, "/api/items", AddRequest{Items: []AddItem{spec, spec}}, &added); status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if len(added.Items) != 2 || queue.Len() != 2 {
+		t.Fatalf("Expected the items to be added even when listed, got %+v", added)
+	}
+
+	item := queue.Get(added.Items[1].ID)
+	if item.Format().Selector() != "137+140" || item.Group != group {
+		t.Errorf("Expected the item to keep its settings, got %+v", added.Items[1])
+	}
+
+	// yt-dlp arguments are not taken from requests
+	var refused map[string]string
+	body := map[string]any{"items": []map[string]any{{"url": "https://example.com/exec", "options": []string{"--exec", "touch pwned"}}}}
+	if status := do(t, server, http.MethodPost, "/api/items", body, &refused); status != http.StatusBadRequest || queue.Len() != 2 {
+		t.Errorf("Expected an item with options to be refused, got %d", status)
+	}
+
+	var failed AddResponse
+	spec.Profile = "unknown"
+	if status := do(t, server, http.MethodPost, "/api/items", AddRequest{Items: []AddItem{spec}}, &failed); status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for an unknown profile, got %d", status)
+	}
+}
+
+func TestServer_Queue(t *testing.T) {
+	server, queue := newTestServer(t, time.Second)
+
+	var added AddResponse
+	do(t, server, http.MethodPost, "/api/items", AddRequest{
+		Urls: []string{"https://example.com/first", "https://example.com/second", "https://example.com/third"},
+	}, &added)
+	first, third := queue.Get(added.Items[0].ID), queue.Get(added.Items[2].ID)
+	waitForStage(t, first, url.StageDownloading)
+
+	if status := do(t, server, http.MethodPost, "/api/items/"+third.ID()+"/move", MoveRequest{Delta: -1}, nil); status != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", status)
+	}
+	if items := queue.Items(); items[1] != third {
+		t.Errorf("Expected the third item to move up, got %s", items[1].Url)
+	}
+
+	var item Item
+	if status := do(t, server, http.MethodPut, "/api/items/"+third.ID()+"/format", url.FormatChoice{Video: "22"}, &item); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if item.Format.Selector() != "22" || third.Format().Selector() != "22" {
+		t.Errorf("Expected the format to be set, got %+v", item.Format)
+	}
+	var failed map[string]string
+	if status := do(t, server, http.MethodPut, "/api/items/"+first.ID()+"/format", url.FormatChoice{Video: "22"}, &failed); status != http.StatusConflict {
+		t.Errorf("Expected 409 for a running item, got %d", status)
+	}
+
+	var info QueueInfo
+	if status := do(t, server, http.MethodPut, "/api/queue", QueueInfo{Concurrency: 3}, &info); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if info.Concurrency != 3 || info.Items != 3 || queue.Concurrency() != 3 {
+		t.Errorf("Expected a concurrency of 3, got %+v", info)
+	}
+	if status := do(t, server, http.MethodPut, "/api/queue", QueueInfo{Concurrency: 0}, &failed); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a concurrency of 0, got %d", status)
+	}
+}
+
+func TestServer_ListenUnix(t *testing.T) {
+	queue := url.NewQueue(1)
+	handler := NewServer(queue, configWithToken(), url.NewMockDownloadExecutor(time.Millisecond, testOutput))
+	path := filepath.Join(t.TempDir(), "api.sock")
+
+	server, err := handler.ListenUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	if _, err := handler.ListenUnix(path); err == nil {
+		t.Error("Expected a socket in use to be refused")
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}}
+	response, err := client.Get("http://unix/api/queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Expected the socket not to need the token, got %d", response.StatusCode)
+	}
+}
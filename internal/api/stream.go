@@ -0,0 +1,350 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+// historySize is the number of events kept for the clients resuming the
+// stream with Last-Event-ID
+const historySize = 1024
+
+// subscriberBuffer is the number of events a client may lag behind before
+// it is disconnected, it then resumes from the history when reconnecting
+const subscriberBuffer = 256
+
+// keepAliveInterval is how often a comment is sent on an idle stream so
+// proxies do not close it
+const keepAliveInterval = 15 * time.Second
+
+// StreamEvent is an event of GET /api/events. Item is a snapshot of the item
+// taken as the event is streamed, holding the stage or progress the event
+// reports. From and To are set on stage changes and Log on log lines.
+type StreamEvent struct {
+	ID     uint64             `json:"id"`
+	Type   url.EventType      `json:"type"`
+	At     time.Time          `json:"at"`
+	ItemID string             `json:"item_id"`
+	From   *url.DownloadStage `json:"from,omitempty"`
+	To     *url.DownloadStage `json:"to,omitempty"`
+	Log    *LogLine           `json:"log,omitempty"`
+	Item   Item               `json:"item"`
+}
+
+// stream numbers the events of the queue and fans them out to the clients
+// of GET /api/events, keeping the last ones to replay. Log lines are only
+// sent to the clients asking for them and are not replayed, the logs
+// endpoint serves the past ones.
+type stream struct {
+	mutex   sync.Mutex
+	history []StreamEvent
+	lastID  uint64
+	// evictedID is the id of the last event dropped from the history, the
+	// clients which missed it cannot resume
+	evictedID   uint64
+	subscribers map[chan StreamEvent]streamFilter
+	closed      bool
+}
+
+func newStream() *stream {
+	return &stream{subscribers: make(map[chan StreamEvent]streamFilter)}
+}
+
+// run publishes the events until the channel is closed
+func (s *stream) run(events <-chan url.Event) {
+	for event := range events {
+		s.publish(event)
+	}
+	s.close()
+}
+
+func (s *stream) publish(event url.Event) {
+	// the item may have moved on since the event was published
+	item := NewItem(event.Item)
+	switch event.Type {
+	case url.EventStageChanged:
+		item.Stage = event.To
+	case url.EventProgress:
+		progress := NewProgress(event.Progress)
+		item.Progress = &progress
+	}
+	var line *LogLine
+	if event.Type == url.EventLogLine {
+		converted := NewLogLine(event.Log)
+		line = &converted
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastID++
+	streamEvent := StreamEvent{
+		ID:     s.lastID,
+		Type:   event.Type,
+		At:     event.At,
+		ItemID: event.Item.ID(),
+		Log:    line,
+		Item:   item,
+	}
+	if event.Type == url.EventStageChanged {
+		from, to := event.From, event.To
+		streamEvent.From, streamEvent.To = &from, &to
+	}
+
+	if event.Type != url.EventLogLine {
+		if len(s.history) == historySize {
+			s.evictedID = s.history[0].ID
+			s.history = slices.Delete(s.history, 0, 1)
+		}
+		s.history = append(s.history, streamEvent)
+	}
+
+	for ch, filter := range s.subscribers {
+		if !filter.match(streamEvent) {
+			continue
+		}
+		select {
+		case ch <- streamEvent:
+		default:
+			// a client that cannot keep up reconnects and replays the history
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// streamResume is how a client is caught up when subscribing
+type streamResume struct {
+	// missed are the events after the last one the client received
+	missed []StreamEvent
+	// reset is set when the events the client missed are no longer kept, or
+	// its last event came from an earlier process. It must then start over
+	// from a snapshot of the items, taken after the event resetID.
+	reset   bool
+	resetID uint64
+}
+
+// subscribe returns how to catch up a client which last received the event
+// lastID, and a channel receiving the next events matching filter until it
+// is closed by the stream or unsubscribe
+func (s *stream) subscribe(lastID uint64, filter streamFilter) (streamResume, <-chan StreamEvent, func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ch := make(chan StreamEvent, subscriberBuffer)
+	if s.closed {
+		close(ch)
+		return streamResume{}, ch, func() {}
+	}
+	s.subscribers[ch] = filter
+
+	var resume streamResume
+	switch {
+	case lastID == 0:
+	case lastID < s.evictedID || lastID > s.lastID:
+		resume.reset, resume.resetID = true, s.lastID
+	default:
+		idx, _ := slices.BinarySearchFunc(s.history, lastID+1, func(event StreamEvent, id uint64) int {
+			return compareUint64(event.ID, id)
+		})
+		for _, event := range s.history[idx:] {
+			if filter.match(event) {
+				resume.missed = append(resume.missed, event)
+			}
+		}
+	}
+
+	unsubscribe := func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+	return resume, ch, unsubscribe
+}
+
+// close ends the streams of every client
+func (s *stream) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	for ch := range s.subscribers {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// streamFilter selects the events sent to a client
+type streamFilter struct {
+	items []string
+	types []url.EventType
+}
+
+// parseStreamFilter reads the ?item= and ?type= parameters, both may be
+// repeated or hold comma separated values
+func parseStreamFilter(r *http.Request) (streamFilter, error) {
+	var filter streamFilter
+	query := r.URL.Query()
+
+	for _, value := range query["item"] {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				filter.items = append(filter.items, id)
+			}
+		}
+	}
+	for _, value := range query["type"] {
+		for _, name := range strings.Split(value, ",") {
+			var eventType url.EventType
+			if err := eventType.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+				return filter, err
+			}
+			filter.types = append(filter.types, eventType)
+		}
+	}
+	return filter, nil
+}
+
+// match tells whether the event is sent to the client, every event but the
+// log lines is sent when no type is given
+func (f streamFilter) match(event StreamEvent) bool {
+	if len(f.items) > 0 && !slices.Contains(f.items, event.ItemID) {
+		return false
+	}
+	if len(f.types) == 0 {
+		return event.Type != url.EventLogLine
+	}
+	return slices.Contains(f.types, event.Type)
+}
+
+// lastEventID reads the id sent by EventSource when reconnecting, or given
+// as ?last_event_id= by clients which cannot set headers
+func lastEventID(r *http.Request) (uint64, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// StreamReset is sent as a reset event to a client resuming the stream after
+// events that are no longer kept, Items replaces what it knew of the items
+type StreamReset struct {
+	ID    uint64 `json:"id"`
+	Items []Item `json:"items"`
+}
+
+// sendReset writes a reset event with the items matching filter, carrying
+// the id of the last event the snapshot accounts for
+func (s *Server) sendReset(w io.Writer, id uint64, filter streamFilter) error {
+	reset := StreamReset{ID: id, Items: []Item{}}
+	for _, item := range s.queue.Items() {
+		if len(filter.items) == 0 || slices.Contains(filter.items, item.ID()) {
+			reset.Items = append(reset.Items, NewItem(item))
+		}
+	}
+
+	data, err := json.Marshal(reset)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: reset\ndata: %s\n\n", id, data)
+	return err
+}
+
+// streamEvents sends the events of the queue as Server-Sent Events, starting
+// with the ones missed since the last event id when resuming, or with a reset
+// event when they are no longer kept
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseStreamFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	lastID, err := lastEventID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid last event id: %w", err))
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	resume, events, unsubscribe := s.stream.subscribe(lastID, filter)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event StreamEvent) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		return err
+	}
+
+	if resume.reset {
+		if err := s.sendReset(w, resume.resetID, filter); err != nil {
+			return
+		}
+	}
+	for _, event := range resume.missed {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+// openStream connects to the event stream with the token as a query
+// parameter, like EventSource clients do
+func openStream(t *testing.T, server *httptest.Server, query string, lastEventID string) *bufio.Reader {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/events?token="+testToken+"&"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", response.StatusCode)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s", contentType)
+	}
+	return bufio.NewReader(response.Body)
+}
+
+// readEvent returns the next event of the stream, skipping comments
+func readEvent(t *testing.T, reader *bufio.Reader) StreamEvent {
+	t.Helper()
+
+	var id, name, data string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Reading the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && data != "":
+			var event StreamEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatal(err)
+			}
+			if strconv.FormatUint(event.ID, 10) != id || event.Type.String() != name {
+				t.Errorf("Expected the id and name of the event to match its data, got %s %s for %+v", id, name, event)
+			}
+			return event
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// readUntil reads events until one of type eventType
+func readUntil(t *testing.T, reader *bufio.Reader, eventType url.EventType) []StreamEvent {
+	t.Helper()
+
+	var events []StreamEvent
+	for {
+		event := readEvent(t, reader)
+		events = append(events, event)
+		if event.Type == eventType {
+			return events
+		}
+	}
+}
+
+func TestServer_Events(t *testing.T) {
+	server, queue := newTestServer(t, 10*time.Millisecond)
+
+	executor := url.NewMockDownloadExecutor(10*time.Millisecond, testOutput)
+	first := url.NewUrlItemEx("https://example.com/first", executor)
+	second := url.NewUrlItemEx("https://example.com/second", executor)
+
+	reader := openStream(t, server, "item="+second.ID(), "")
+	queue.Add(first, second)
+
+	events := readUntil(t, reader, url.EventFinished)
+
+	var stages []url.DownloadStage
+	for _, event := range events {
+		if event.ItemID != second.ID() || event.Item.ID != second.ID() {
+			t.Errorf("Expected only the events of the second item, got %+v", event)
+		}
+		if event.Type == url.EventStageChanged {
+			if event.From == nil || event.To == nil || event.Item.Stage != *event.To {
+				t.Errorf("Expected the stage change in the event and its item, got %+v", event)
+				continue
+			}
+			stages = append(stages, *event.To)
+		}
+	}
+
+	if events[0].Type != url.EventAdded {
+		t.Errorf("Expected the item to be added first, got %s", events[0].Type)
+	}
+	if len(stages) == 0 || stages[len(stages)-1] != url.StageCompleted {
+		t.Errorf("Expected the stage changes up to Completed, got %v", stages)
+	}
+	last := events[len(events)-1]
+	if last.Item.StartedAt == nil || last.Item.StoppedAt == nil {
+		t.Errorf("Expected the start and stop times on the finished item, got %+v", last.Item)
+	}
+	for idx := 1; idx < len(events); idx++ {
+		if events[idx].ID <= events[idx-1].ID {
+			t.Errorf("Expected increasing ids, got %d after %d", events[idx].ID, events[idx-1].ID)
+		}
+	}
+}
+
+func TestServer_EventsResume(t *testing.T) {
+	server, queue := newTestServer(t, 10*time.Millisecond)
+
+	executor := url.NewMockDownloadExecutor(10*time.Millisecond, testOutput)
+	first := url.NewUrlItemEx("https://example.com/first", executor)
+	second := url.NewUrlItemEx("https://example.com/second", executor)
+
+	reader := openStream(t, server, "", "")
+	queue.Add(first, second)
+
+	var events []StreamEvent
+	for finished := 0; finished < 2; {
+		event := readEvent(t, reader)
+		events = append(events, event)
+		if event.Type == url.EventFinished {
+			finished++
+		}
+	}
+
+	// reconnecting replays the events after the last one received
+	resumed := openStream(t, server, "", strconv.FormatUint(events[2].ID, 10))
+	for _, expected := range events[3:] {
+		if event := readEvent(t, resumed); event.ID != expected.ID || event.Type != expected.Type {
+			t.Fatalf("Expected event %d (%s), got %d (%s)", expected.ID, expected.Type, event.ID, event.Type)
+		}
+	}
+
+	// the filters apply to the replayed events
+	filtered := openStream(t, server, "type=finished,failed&last_event_id=1", "")
+	for _, item := range []*url.UrlItem{first, second} {
+		event := readEvent(t, filtered)
+		if event.Type != url.EventFinished || event.ItemID != item.ID() {
+			t.Errorf("Expected %s to finish, got %+v", item.Url, event)
+		}
+	}
+}
+
+func TestServer_EventsInvalid(t *testing.T) {
+	server, _ := newTestServer(t, time.Millisecond)
+
+	var failed map[string]string
+	for _, path := range []string{"/api/events?type=unknown", "/api/events?last_event_id=x"} {
+		if status := do(t, server, http.MethodGet, path, nil, &failed); status != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, status)
+		}
+	}
+}
+
+func TestServer_EventsClose(t *testing.T) {
+	executor := url.NewMockDownloadExecutor(time.Millisecond, testOutput)
+	queue := url.NewQueue(1)
+	handler := NewServer(queue, configWithToken(), executor)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	reader := openStream(t, server, "", "")
+	handler.Close()
+
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Error("Expected the stream to end once the server is closed")
+	}
+}
+
+func TestServer_EventsLogs(t *testing.T) {
+	server, queue := newTestServer(t, 10*time.Millisecond)
+
+	item := url.NewUrlItemEx("https://example.com/video", url.NewMockDownloadExecutor(10*time.Millisecond, testOutput))
+	reader := openStream(t, server, "type=log,finished", "")
+	queue.Add(item)
+
+	events := readUntil(t, reader, url.EventFinished)
+	if len(events) != 3 {
+		t.Fatalf("Expected 2 log lines before the end, got %+v", events)
+	}
+	for idx, text := range []string{"[info] Downloading", "[download] Destination: video.mp4"} {
+		line := events[idx].Log
+		if events[idx].Type != url.EventLogLine || line == nil || line.Text != text || line.Seq != uint64(idx+1) {
+			t.Errorf("Event[%d]: expected the line %q, got %+v", idx, text, events[idx])
+		}
+	}
+
+	// log lines are not replayed, the logs endpoint serves them
+	resumed := openStream(t, server, "type=log,finished&last_event_id=1", "")
+	if event := readEvent(t, resumed); event.Type != url.EventFinished {
+		t.Errorf("Expected only the finished event to be replayed, got %+v", event)
+	}
+}
+
+func TestServer_EventsReset(t *testing.T) {
+	server, queue := newTestServer(t, 10*time.Millisecond)
+
+	item := url.NewUrlItemEx("https://example.com/video", url.NewMockDownloadExecutor(10*time.Millisecond, testOutput))
+	queue.Add(item)
+	waitForStage(t, item, url.StageCompleted)
+
+	// an id from an earlier daemon cannot be resumed from
+	reader := openStream(t, server, "", "1000000")
+	var name, data string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Reading the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" && data != "" {
+			break
+		}
+		if value, ok := strings.CutPrefix(line, "event: "); ok {
+			name = value
+		}
+		if value, ok := strings.CutPrefix(line, "data: "); ok {
+			data = value
+		}
+	}
+
+	var reset StreamReset
+	if err := json.Unmarshal([]byte(data), &reset); err != nil {
+		t.Fatal(err)
+	}
+	if name != "reset" || len(reset.Items) != 1 || reset.Items[0].ID != item.ID() || reset.Items[0].Stage != url.StageCompleted {
+		t.Errorf("Expected a reset with the completed item, got %s %+v", name, reset)
+	}
+}
+
+func TestStream_Resume(t *testing.T) {
+	s := newStream()
+	item := url.NewUrlItemEx("https://example.com/video", url.NewMockDownloadExecutor(time.Millisecond, testOutput))
+	for range historySize + 10 {
+		s.publish(url.Event{Type: url.EventMetadata, Item: item})
+	}
+
+	resume, _, unsubscribe := s.subscribe(s.lastID-1, streamFilter{})
+	unsubscribe()
+	if resume.reset || len(resume.missed) != 1 || resume.missed[0].ID != s.lastID {
+		t.Errorf("Expected the last event to be replayed, got %+v", resume)
+	}
+
+	// the first events were evicted from the history
+	resume, _, unsubscribe = s.subscribe(5, streamFilter{})
+	unsubscribe()
+	if !resume.reset || resume.resetID != s.lastID || len(resume.missed) != 0 {
+		t.Errorf("Expected a reset after evicted events, got reset %v at %d", resume.reset, resume.resetID)
+	}
+}
@@ -0,0 +1,465 @@
+// Package cli runs the commands given on the command line, for scripts and
+// cron jobs. They act on the daemon when one is running, and on the saved
+// downloads otherwise.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/api"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/daemon"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/storage"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+// Exit statuses of Run
+const (
+	ExitOK     = 0
+	ExitFailed = 1
+	ExitUsage  = 2
+)
+
+// Options are the settings shared by the commands
+type Options struct {
+	Config     config.Config
+	Store      storage.Storage
+	SocketPath string
+	Executor   url.CommandExecutor
+	Stdout     io.Writer
+	Stderr     io.Writer
+}
+
+type command struct {
+	args  string
+	usage string
+	run   func(ctx context.Context, opts Options, flags *flag.FlagSet, args []string) int
+}
+
+var commands = map[string]command{
+	"add": {
+		args:  "[-profile name] [-wait] url...",
+		usage: "queue urls, the daemon downloads them in the background",
+		run:   runAdd,
+	},
+	"import": {
+		args:  "[-profile name] [-wait] file",
+		usage: "queue the urls of a batch file, - for stdin",
+		run:   runImport,
+	},
+	"list": {
+		args:  "[-json]",
+		usage: "list the downloads",
+		run:   runList,
+	},
+	"remove": {
+		args:  "id...",
+		usage: "remove downloads, stopping them",
+		run:   runRemove,
+	},
+	"wait": {
+		args:  "[id...]",
+		usage: "wait for the downloads to complete, running them without a daemon",
+		run:   runWait,
+	},
+}
+
+// IsCommand tells whether name is one of the commands run by Run
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Run executes the command named by args[0] and returns the exit status.
+// Without a daemon, add, import and wait download the queued items until
+// they complete or ctx is done, printing their progress.
+func Run(ctx context.Context, opts Options, args []string) int {
+	if len(args) == 0 || !IsCommand(args[0]) {
+		Usage(opts.Stderr)
+		return ExitUsage
+	}
+
+	name, command := args[0], commands[args[0]]
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(opts.Stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(opts.Stderr, "Usage: %s %s\n", name, command.args)
+		flags.PrintDefaults()
+	}
+	return command.run(ctx, opts, flags, args[1:])
+}
+
+// Usage lists the commands
+func Usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	fmt.Fprintln(w, "Commands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s %s\n    \t%s\n", name, commands[name].args, commands[name].usage)
+	}
+}
+
+// dial attaches to the daemon, nil when none is running
+func (o Options) dial() (*daemon.Client, error) {
+	if !daemon.Running(o.SocketPath) {
+		return nil, nil
+	}
+	return daemon.Dial(o.SocketPath, o.Config, o.Executor)
+}
+
+func (o Options) profile(name string) (config.Profile, error) {
+	if name == "" {
+		if len(o.Config.Profiles) > 0 {
+			return o.Config.Profiles[0], nil
+		}
+		return config.Profile{}, nil
+	}
+	profile, ok := o.Config.Profile(name)
+	if !ok {
+		return profile, fmt.Errorf("unknown profile %q", name)
+	}
+	return profile, nil
+}
+
+// lock claims the download list for a command running without a daemon
+func (o Options) lock() (func() error, error) {
+	unlock, err := o.Store.Lock()
+	if errors.Is(err, storage.ErrLocked) {
+		return nil, fmt.Errorf("%w, run the daemon to share it", err)
+	}
+	return unlock, err
+}
+
+func (o Options) fail(err error) int {
+	fmt.Fprintln(o.Stderr, err)
+	return ExitFailed
+}
+
+func runAdd(ctx context.Context, opts Options, flags *flag.FlagSet, args []string) int {
+	profileName := flags.String("profile", "", "profile of the urls, the first one by default")
+	wait := flags.Bool("wait", false, "wait for the daemon to download them")
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	entries := make([]url.BatchEntry, 0, flags.NArg())
+	for idx, rawUrl := range flags.Args() {
+		entries = append(entries, url.BatchEntry{Line: idx + 1, Url: rawUrl})
+	}
+	return addEntries(ctx, opts, entries, *profileName, *wait)
+}
+
+func runImport(ctx context.Context, opts Options, flags *flag.FlagSet, args []string) int {
+	profileName := flags.String("profile", "", "profile of the urls, the first one by default")
+	wait := flags.Bool("wait", false, "wait for the daemon to download them")
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	path, err := config.ExpandHome(flags.Arg(0))
+	if err != nil {
+		return opts.fail(err)
+	}
+	entries, err := url.ReadBatchFile(path)
+	if err != nil {
+		return opts.fail(fmt.Errorf("could not import urls: %w", err))
+	}
+	return addEntries(ctx, opts, entries, *profileName, *wait)
+}
+
+// addEntries queues the urls of entries, the skipped ones are reported. The
+// daemon downloads them in the background unless wait is set, without a
+// daemon they are downloaded right away along with the other queued items.
+func addEntries(ctx context.Context, opts Options, entries []url.BatchEntry, profileName string, wait bool) int {
+	profile, err := opts.profile(profileName)
+	if err != nil {
+		return opts.fail(err)
+	}
+
+	client, err := opts.dial()
+	if err != nil {
+		return opts.fail(err)
+	}
+	if client == nil {
+		return runLocal(ctx, opts, func(saved []*url.UrlItem) ([]*url.UrlItem, int) {
+			find := func(rawUrl string) *url.UrlItem { return url.FindUrl(saved, rawUrl) }
+			items, errs := url.NewBatchItems(entries, find, opts.Config, profile, opts.Executor)
+			for _, err := range errs {
+				fmt.Fprintf(opts.Stderr, "skipped %v\n", err)
+			}
+			if len(items) == 0 {
+				return nil, ExitFailed
+			}
+			return items, ExitOK
+		})
+	}
+	defer client.Close()
+
+	items, errs := client.BatchItems(entries, opts.Config, profile, opts.Executor)
+	for _, err := range errs {
+		fmt.Fprintf(opts.Stderr, "skipped %v\n", err)
+	}
+	added, err := client.AddItems(items...)
+	if err != nil {
+		fmt.Fprintln(opts.Stderr, err)
+	}
+	printAdded(opts.Stdout, added)
+	if len(added) == 0 {
+		return ExitFailed
+	}
+
+	if !wait {
+		return ExitOK
+	}
+	return waitItems(ctx, opts, client.Events(), added)
+}
+
+func printAdded(w io.Writer, items []*url.UrlItem) {
+	for _, item := range items {
+		fmt.Fprintf(w, "added %s %s\n", item.ID(), item.Url)
+	}
+}
+
+// runLocal downloads the saved items, and the ones returned by prepare, until
+// none is left running or ctx is done. Nothing starts when prepare fails. The
+// list is locked meanwhile and saved when returning, interrupted downloads
+// resume on the next run.
+func runLocal(ctx context.Context, opts Options, prepare func(saved []*url.UrlItem) ([]*url.UrlItem, int)) int {
+	unlock, err := opts.lock()
+	if err != nil {
+		return opts.fail(err)
+	}
+	defer unlock()
+
+	items, err := storage.LoadItems(opts.Store, opts.Config, opts.Executor)
+	if err != nil {
+		return opts.fail(err)
+	}
+	var added []*url.UrlItem
+	if prepare != nil {
+		var status int
+		if added, status = prepare(items); status != ExitOK {
+			return status
+		}
+	}
+
+	queue := url.NewQueue(opts.Config.Concurrency)
+	queue.ApplyConfig(opts.Config)
+	defer queue.StopAll()
+	// subscribing before the items start, so no change is missed
+	printer := newPrinter(opts.Stdout)
+	events, unsubscribe := printer.subscribe(queue.Events())
+	defer unsubscribe()
+
+	queue.Restore(items...)
+	queue.Add(added...)
+	printAdded(opts.Stdout, added)
+
+	waited, err := printer.follow(ctx, events, queue.Items())
+	if saveErr := storage.SaveItems(opts.Store, queue.Items()); saveErr != nil {
+		fmt.Fprintln(opts.Stderr, saveErr)
+	}
+	if err != nil {
+		return opts.fail(err)
+	}
+	return waitStatus(opts, waited)
+}
+
+// waitItems prints the progress of the items run by the daemon until they
+// complete
+func waitItems(ctx context.Context, opts Options, bus *url.Bus, items []*url.UrlItem) int {
+	printer := newPrinter(opts.Stdout)
+	events, unsubscribe := printer.subscribe(bus)
+	defer unsubscribe()
+
+	waited, err := printer.follow(ctx, events, items)
+	if err != nil {
+		return opts.fail(err)
+	}
+	return waitStatus(opts, waited)
+}
+
+// waitStatus reports the items which failed, the exit status is ExitFailed
+// when there is one
+func waitStatus(opts Options, items []*url.UrlItem) int {
+	status := ExitOK
+	for _, item := range items {
+		if item.Stage() == url.StageError {
+			fmt.Fprintf(opts.Stderr, "%s failed: %s\n", item.ID(), item.Failure())
+			status = ExitFailed
+		}
+	}
+	return status
+}
+
+func runList(ctx context.Context, opts Options, flags *flag.FlagSet, args []string) int {
+	asJSON := flags.Bool("json", false, "print the items as JSON, like the api")
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return ExitUsage
+	}
+
+	var items []*url.UrlItem
+	client, err := opts.dial()
+	switch {
+	case err != nil:
+		return opts.fail(err)
+	case client != nil:
+		defer client.Close()
+		items = client.Items()
+	default:
+		if items, err = storage.LoadItems(opts.Store, opts.Config, opts.Executor); err != nil {
+			return opts.fail(err)
+		}
+	}
+
+	if *asJSON {
+		result := make([]api.Item, 0, len(items))
+		for _, item := range items {
+			result = append(result, api.NewItem(item))
+		}
+		encoder := json.NewEncoder(opts.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			return opts.fail(err)
+		}
+		return ExitOK
+	}
+
+	writer := tabwriter.NewWriter(opts.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tSTAGE\tPROGRESS\tTITLE")
+	for _, item := range items {
+		progress := "-"
+		if p := item.Progress(); p.Known() {
+			progress = fmt.Sprintf("%.1f%%", p.Percent)
+		} else if item.Stage() == url.StageCompleted {
+			progress = "100.0%"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", item.ID(), item.Stage(), progress, item.Title())
+	}
+	if err := writer.Flush(); err != nil {
+		return opts.fail(err)
+	}
+	return ExitOK
+}
+
+func runRemove(ctx context.Context, opts Options, flags *flag.FlagSet, args []string) int {
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return ExitUsage
+	}
+	ids := flags.Args()
+
+	client, err := opts.dial()
+	if err != nil {
+		return opts.fail(err)
+	}
+	if client != nil {
+		defer client.Close()
+
+		var errs []error
+		for _, id := range ids {
+			item := client.Get(id)
+			if item == nil {
+				errs = append(errs, fmt.Errorf("no item with id %s", id))
+				continue
+			}
+			if err := client.RemoveItem(item); err != nil {
+				errs = append(errs, fmt.Errorf("could not remove %s: %w", id, err))
+				continue
+			}
+			fmt.Fprintf(opts.Stdout, "removed %s %s\n", id, item.Url)
+		}
+		if err := errors.Join(errs...); err != nil {
+			return opts.fail(err)
+		}
+		return ExitOK
+	}
+
+	unlock, err := opts.lock()
+	if err != nil {
+		return opts.fail(err)
+	}
+	defer unlock()
+
+	items, err := storage.LoadItems(opts.Store, opts.Config, opts.Executor)
+	if err != nil {
+		return opts.fail(err)
+	}
+	var errs []error
+	for _, id := range ids {
+		idx := slices.IndexFunc(items, func(item *url.UrlItem) bool {
+			return item.ID() == id
+		})
+		if idx < 0 {
+			errs = append(errs, fmt.Errorf("no item with id %s", id))
+			continue
+		}
+		fmt.Fprintf(opts.Stdout, "removed %s %s\n", id, items[idx].Url)
+		items = slices.Delete(items, idx, idx+1)
+	}
+	if err := storage.SaveItems(opts.Store, items); err != nil {
+		return opts.fail(err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return opts.fail(err)
+	}
+	return ExitOK
+}
+
+func runWait(ctx context.Context, opts Options, flags *flag.FlagSet, args []string) int {
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+	ids := flags.Args()
+
+	client, err := opts.dial()
+	if err != nil {
+		return opts.fail(err)
+	}
+	if client == nil {
+		if len(ids) > 0 {
+			return opts.fail(errors.New("waiting for some items needs a running daemon"))
+		}
+		return runLocal(ctx, opts, nil)
+	}
+	defer client.Close()
+
+	items := client.Items()
+	if len(ids) > 0 {
+		items = items[:0]
+		for _, id := range ids {
+			item := client.Get(id)
+			if item == nil {
+				return opts.fail(fmt.Errorf("no item with id %s", id))
+			}
+			items = append(items, item)
+		}
+	}
+	return waitItems(ctx, opts, client.Events(), items)
+}
@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/api"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/daemon"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/storage"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/testutil"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+// testOutput is printed by the mock downloads of the tests
+const testOutput = "[download]  50.0% of 10.00MiB at 1.00MiB/s ETA 00:05\n"
+
+type testRun struct {
+	opts   Options
+	stdout *bytes.Buffer
+	stderr *bytes.Buffer
+}
+
+func newTestRun(t *testing.T) *testRun {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.PrefetchMetadata = false
+	cfg.Retry.MaxAttempts = 1
+
+	dir := t.TempDir()
+	run := &testRun{stdout: &bytes.Buffer{}, stderr: &bytes.Buffer{}}
+	run.opts = Options{
+		Config:     cfg,
+		Store:      storage.NewFileStorage(filepath.Join(dir, "downloads.json")),
+		SocketPath: filepath.Join(dir, "daemon.sock"),
+		Executor:   url.NewMockDownloadExecutor(10*time.Millisecond, testOutput),
+		Stdout:     run.stdout,
+		Stderr:     run.stderr,
+	}
+	return run
+}
+
+func (r *testRun) run(t *testing.T, args ...string) int {
+	t.Helper()
+
+	r.stdout.Reset()
+	r.stderr.Reset()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return Run(ctx, r.opts, args)
+}
+
+func (r *testRun) list(t *testing.T) []api.Item {
+	t.Helper()
+
+	if status := r.run(t, "list", "--json"); status != ExitOK {
+		t.Fatalf("Expected list to succeed, got %d: %s", status, r.stderr)
+	}
+	var items []api.Item
+	if err := json.Unmarshal(r.stdout.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestRun_Usage(t *testing.T) {
+	run := newTestRun(t)
+
+	for _, args := range [][]string{nil, {"unknown"}, {"add"}, {"import", "a", "b"}, {"list", "-x"}} {
+		if status := run.run(t, args...); status != ExitUsage {
+			t.Errorf("%v: expected the usage status, got %d", args, status)
+		}
+	}
+}
+
+func TestRun_Local(t *testing.T) {
+	run := newTestRun(t)
+
+	if status := run.run(t, "add", "https://example.com/video", "https://example.com/video"); status != ExitOK {
+		t.Fatalf("Expected the download to complete, got %d: %s", status, run.stderr)
+	}
+	output := run.stdout.String()
+	for _, expected := range []string{"added ", " Downloading ", " 50.0% of 10.0MiB at 1.0MiB/s ETA 5s", " Completed "} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in the output, got:\n%s", expected, output)
+		}
+	}
+	if !strings.Contains(run.stderr.String(), "already in the list") {
+		t.Errorf("Expected the duplicate to be skipped, got %q", run.stderr)
+	}
+
+	if status := run.run(t, "add", "https://example.com/fail"); status != ExitFailed {
+		t.Errorf("Expected a failed download to fail the command, got %d", status)
+	}
+
+	items := run.list(t)
+	if len(items) != 2 || items[0].Stage != url.StageCompleted || items[1].Stage != url.StageError {
+		t.Fatalf("Expected the completed and failed items to be saved, got %+v", items)
+	}
+
+	if status := run.run(t, "list"); status != ExitOK || !strings.Contains(run.stdout.String(), "Completed") {
+		t.Errorf("Expected a table of the items, got %d:\n%s", status, run.stdout)
+	}
+
+	if status := run.run(t, "remove", "missing"); status != ExitFailed {
+		t.Errorf("Expected an unknown id to fail the command, got %d", status)
+	}
+	// the ids are saved with the items, so the listed one is found again
+	if status := run.run(t, "remove", items[1].ID); status != ExitOK {
+		t.Errorf("Expected the item to be removed, got %d: %s", status, run.stderr)
+	}
+	if left := run.list(t); len(left) != 1 || left[0].ID != items[0].ID {
+		t.Errorf("Expected the completed item left, got %+v", left)
+	}
+
+	// nothing is left to download
+	if status := run.run(t, "wait"); status != ExitOK {
+		t.Errorf("Expected wait to return right away, got %d: %s", status, run.stderr)
+	}
+}
+
+func TestRun_LocalLocked(t *testing.T) {
+	run := newTestRun(t)
+
+	unlock, err := run.opts.Store.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	for _, args := range [][]string{{"add", "https://example.com/video"}, {"remove", "id"}, {"wait"}} {
+		if status := run.run(t, args...); status != ExitFailed || !strings.Contains(run.stderr.String(), "in use") {
+			t.Errorf("%v: expected the locked list to be refused, got %d: %s", args, status, run.stderr)
+		}
+	}
+}
+
+func TestRun_LocalInvalid(t *testing.T) {
+	run := newTestRun(t)
+	if err := run.opts.Store.Save([]url.ItemState{{Url: "https://example.com/saved", Stage: url.StageQueued}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var started atomic.Int32
+	executor := url.NewMockDownloadExecutor(10*time.Millisecond, testOutput)
+	create := executor.CreateCommandFunc
+	executor.CreateCommandFunc = func(name string, args ...string) url.Command {
+		started.Add(1)
+		return create(name, args...)
+	}
+	run.opts.Executor = executor
+
+	if status := run.run(t, "add", "not a url"); status != ExitFailed {
+		t.Fatalf("Expected the invalid url to fail the command, got %d", status)
+	}
+	if started.Load() != 0 {
+		t.Errorf("Expected the saved item not to start, got %d downloads", started.Load())
+	}
+	if items := run.list(t); len(items) != 1 || items[0].Stage != url.StageQueued {
+		t.Errorf("Expected the saved item to be left queued, got %+v", items)
+	}
+}
+
+func TestRun_Import(t *testing.T) {
+	run := newTestRun(t)
+
+	path := filepath.Join(t.TempDir(), "urls.txt")
+	if err := os.WriteFile(path, []byte("# videos\nhttps://example.com/a\nnot a url\nhttps://example.com/b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := run.run(t, "import", path); status != ExitOK {
+		t.Fatalf("Expected the import to succeed, got %d: %s", status, run.stderr)
+	}
+	if !strings.Contains(run.stderr.String(), "line 3") {
+		t.Errorf("Expected the invalid line to be reported, got %q", run.stderr)
+	}
+	if items := run.list(t); len(items) != 2 {
+		t.Errorf("Expected 2 items, got %+v", items)
+	}
+}
+
+func TestRun_Daemon(t *testing.T) {
+	run := newTestRun(t)
+	// long enough to follow the download once added
+	run.opts.Executor = url.NewMockDownloadExecutor(200*time.Millisecond, testOutput)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- daemon.Run(ctx, run.opts.Config, run.opts.Store, run.opts.SocketPath, run.opts.Executor)
+	}()
+	defer func() {
+		cancel()
+		if err := <-stopped; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	testutil.WaitFor(t, "the daemon to listen on its socket", func() bool {
+		return daemon.Running(run.opts.SocketPath)
+	})
+
+	if status := run.run(t, "add", "-wait", "https://example.com/video"); status != ExitOK {
+		t.Fatalf("Expected the daemon to download the item, got %d: %s", status, run.stderr)
+	}
+	if !strings.Contains(run.stdout.String(), " Completed ") {
+		t.Errorf("Expected the progress to be printed, got:\n%s", run.stdout)
+	}
+
+	if status := run.run(t, "add", "https://example.com/fail"); status != ExitOK {
+		t.Fatalf("Expected the item to be added, got %d: %s", status, run.stderr)
+	}
+	if status := run.run(t, "wait"); status != ExitOK && status != ExitFailed {
+		t.Errorf("Expected wait to return, got %d", status)
+	}
+
+	items := run.list(t)
+	if len(items) != 2 || items[0].Stage != url.StageCompleted || items[1].Stage != url.StageError {
+		t.Fatalf("Expected the items of the daemon, got %+v", items)
+	}
+	if status := run.run(t, "remove", items[1].ID); status != ExitOK {
+		t.Errorf("Expected the item to be removed, got %d: %s", status, run.stderr)
+	}
+	if items := run.list(t); len(items) != 1 {
+		t.Errorf("Expected 1 item left, got %+v", items)
+	}
+}
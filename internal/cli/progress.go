@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+// progressInterval is how often the progress of an item is printed
+const progressInterval = time.Second
+
+// pollInterval is how often the stages are checked, in case the events of
+// a change were dropped
+const pollInterval = time.Second
+
+// printer writes the changes of the items as plain text, one line each
+type printer struct {
+	w            io.Writer
+	lastProgress map[*url.UrlItem]time.Time
+}
+
+func newPrinter(w io.Writer) *printer {
+	return &printer{w: w, lastProgress: make(map[*url.UrlItem]time.Time)}
+}
+
+func (p *printer) subscribe(bus *url.Bus) (<-chan url.Event, func()) {
+	return bus.SubscribeBuffered(1024,
+		url.EventProgress, url.EventStageChanged, url.EventFailed, url.EventRemoved,
+	)
+}
+
+// follow prints the events of items until none of them is queued or running,
+// and returns the ones it waited for
+func (p *printer) follow(ctx context.Context, events <-chan url.Event, items []*url.UrlItem) ([]*url.UrlItem, error) {
+	pending := slices.DeleteFunc(slices.Clone(items), func(item *url.UrlItem) bool {
+		return !active(item)
+	})
+	waiting := slices.Clone(pending)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for len(waiting) > 0 {
+		select {
+		case <-ctx.Done():
+			return pending, ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				return pending, fmt.Errorf("stopped receiving the changes of the downloads")
+			}
+			if !slices.Contains(pending, event.Item) {
+				continue
+			}
+			if event.Type == url.EventRemoved {
+				fmt.Fprintf(p.w, "%s removed\n", event.Item.ID())
+				waiting = slices.DeleteFunc(waiting, func(item *url.UrlItem) bool {
+					return item == event.Item
+				})
+				continue
+			}
+			p.print(event)
+		case <-ticker.C:
+		}
+		waiting = slices.DeleteFunc(waiting, settled)
+	}
+
+	// the last changes may be seen before their events
+	for {
+		select {
+		case event, ok := <-events:
+			if ok && slices.Contains(pending, event.Item) && event.Type != url.EventRemoved {
+				p.print(event)
+				continue
+			}
+		default:
+		}
+		return pending, nil
+	}
+}
+
+func (p *printer) print(event url.Event) {
+	item := event.Item
+
+	switch event.Type {
+	case url.EventStageChanged:
+		fmt.Fprintf(p.w, "%s %s %s\n", item.ID(), event.To, item.Title())
+	case url.EventFailed:
+		if event.Failure != nil {
+			fmt.Fprintf(p.w, "%s failed: %s\n", item.ID(), event.Failure)
+		}
+	case url.EventProgress:
+		if time.Since(p.lastProgress[item]) < progressInterval {
+			return
+		}
+		p.lastProgress[item] = time.Now()
+		if text := formatProgress(event.Progress); text != "" {
+			fmt.Fprintf(p.w, "%s %s\n", item.ID(), text)
+		}
+	}
+}
+
+// active tells whether the item is queued, running or waiting to be retried
+func active(item *url.UrlItem) bool {
+	stage := item.Stage()
+	return stage == url.StageQueued || stage.Running() ||
+		(stage == url.StageError && !item.NextRetryAt().IsZero())
+}
+
+// settled tells whether an active item is done for now. A failure the retry
+// policy allows is about to be retried even if it is not scheduled yet.
+func settled(item *url.UrlItem) bool {
+	if item.Stage() == url.StageError && item.Retry.ShouldRetry(item.Failure(), item.Attempts()) {
+		return false
+	}
+	return !active(item)
+}
+
+func formatProgress(p url.Progress) string {
+	if !p.Known() {
+		return ""
+	}
+
+	text := fmt.Sprintf("%5.1f%%", p.Percent)
+	if p.TotalBytes > 0 {
+		text += fmt.Sprintf(" of %s", url.FormatBytes(float64(p.TotalBytes)))
+	}
+	if p.Speed > 0 {
+		text += fmt.Sprintf(" at %s/s", url.FormatBytes(p.Speed))
+	}
+	if p.ETA > 0 {
+		text += fmt.Sprintf(" ETA %v", p.ETA)
+	}
+	return text
+}
@@ -0,0 +1,72 @@
+package clipboard
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrNoCommand is returned when no clipboard command is found on the system
+var ErrNoCommand = errors.New("no clipboard command found, set clipboard.command in the config")
+
+// Source reads the text currently in the clipboard
+type Source interface {
+	Read() (string, error)
+}
+
+// CommandSource reads the clipboard from the output of a command such as
+// wl-paste or pbpaste
+type CommandSource struct {
+	Name string
+	Args []string
+}
+
+func (c CommandSource) Read() (string, error) {
+	output, err := exec.Command(c.Name, c.Args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s: %s", c.Name, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("%s: %w", c.Name, err)
+	}
+	return string(output), nil
+}
+
+// candidates are the clipboard commands tried in order when none is configured
+func candidates() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbpaste"}}
+	case "windows":
+		return [][]string{{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard"}}
+	}
+
+	var commands [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		commands = append(commands, []string{"wl-paste", "--no-newline"})
+	}
+	return append(commands,
+		[]string{"xclip", "-selection", "clipboard", "-o"},
+		[]string{"xsel", "--clipboard", "--output"},
+		[]string{"termux-clipboard-get"},
+	)
+}
+
+// NewSource returns a source running command, or the first clipboard command
+// of the platform found in the PATH when command is empty
+func NewSource(command []string) (Source, error) {
+	if len(command) > 0 {
+		return CommandSource{Name: command[0], Args: command[1:]}, nil
+	}
+
+	for _, candidate := range candidates() {
+		if _, err := exec.LookPath(candidate[0]); err == nil {
+			return CommandSource{Name: candidate[0], Args: candidate[1:]}, nil
+		}
+	}
+	return nil, ErrNoCommand
+}
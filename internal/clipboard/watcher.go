@@ -0,0 +1,117 @@
+package clipboard
+
+import (
+	"log"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+// Watcher reports the video urls copied to the clipboard
+type Watcher struct {
+	source Source
+	hosts  []string
+	last   string
+	primed bool
+}
+
+// NewWatcher returns a watcher picking up the urls of hosts, or any http or
+// https url when hosts is empty
+func NewWatcher(source Source, hosts []string) *Watcher {
+	return &Watcher{source: source, hosts: hosts}
+}
+
+// Poll reads the clipboard and returns its urls when it changed since the
+// last call. The first call only records the content, so whatever was copied
+// before the watcher started is not picked up.
+func (w *Watcher) Poll() ([]string, error) {
+	text, err := w.source.Read()
+	if err != nil {
+		return nil, err
+	}
+	if w.primed && text == w.last {
+		return nil, nil
+	}
+
+	primed := w.primed
+	w.last, w.primed = text, true
+	if !primed {
+		return nil, nil
+	}
+	return Urls(text, w.hosts), nil
+}
+
+// Run polls the clipboard every interval until stop is closed, found is
+// called with the urls of every new clipboard content holding some
+func (w *Watcher) Run(interval time.Duration, stop <-chan struct{}, found func(urls []string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		urls, err := w.Poll()
+		if err != nil {
+			// a failing command fails on every poll, report it once
+			if err.Error() != lastErr {
+				lastErr = err.Error()
+				log.Printf("reading the clipboard: %v", err)
+			}
+			continue
+		}
+		lastErr = ""
+		if len(urls) > 0 {
+			found(urls)
+		}
+	}
+}
+
+// Urls returns the http and https urls of hosts found in text as they were
+// copied, in order and without the ones equal to an earlier url once
+// normalized
+func Urls(text string, hosts []string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+
+	for _, field := range strings.Fields(text) {
+		field = strings.Trim(field, `"'<>()[]{},;`)
+		lower := strings.ToLower(field)
+		if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+			continue
+		}
+
+		normalized, err := url.Normalize(field)
+		if err != nil || seen[normalized] || !matchHost(normalized, hosts) {
+			continue
+		}
+		seen[normalized] = true
+		urls = append(urls, field)
+	}
+	return urls
+}
+
+func matchHost(rawUrl string, hosts []string) bool {
+	if len(hosts) == 0 {
+		return true
+	}
+
+	parsed, err := neturl.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, allowed := range hosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
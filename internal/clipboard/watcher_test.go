@@ -0,0 +1,141 @@
+package clipboard
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSource is a clipboard holding the text set by the test
+type fakeSource struct {
+	mutex sync.Mutex
+	text  string
+	err   error
+	reads int
+}
+
+func (f *fakeSource) Read() (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.reads++
+	return f.text, f.err
+}
+
+func (f *fakeSource) Reads() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.reads
+}
+
+func (f *fakeSource) Set(text string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.text, f.err = text, err
+}
+
+func TestUrls(t *testing.T) {
+	text := `look at this <https://youtu.be/dQw4w9WgXcQ?si=share> and
+"https://www.youtube.com/watch?v=dQw4w9WgXcQ", also https://vimeo.com/76979871,
+https://example.com/page and youtube.com/watch?v=aaaaaaaaaaa without a scheme`
+
+	urls := Urls(text, []string{"youtube.com", "vimeo.com"})
+	expected := []string{"https://youtu.be/dQw4w9WgXcQ?si=share", "https://vimeo.com/76979871"}
+	if !slices.Equal(urls, expected) {
+		t.Errorf("Expected %v, got %v", expected, urls)
+	}
+
+	urls = Urls(text, nil)
+	if !slices.Contains(urls, "https://example.com/page") || len(urls) != 3 {
+		t.Errorf("Expected every url without hosts, got %v", urls)
+	}
+}
+
+func TestWatcher_Poll(t *testing.T) {
+	source := &fakeSource{text: "https://youtu.be/dQw4w9WgXcQ"}
+	watcher := NewWatcher(source, []string{"youtube.com"})
+
+	// the content found when the watcher starts is ignored
+	if urls, err := watcher.Poll(); err != nil || len(urls) != 0 {
+		t.Fatalf("Expected nothing on the first poll, got %v, %v", urls, err)
+	}
+
+	source.Set("https://www.youtube.com/shorts/aaaaaaaaaaa", nil)
+	urls, err := watcher.Poll()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !slices.Equal(urls, []string{"https://www.youtube.com/shorts/aaaaaaaaaaa"}) {
+		t.Errorf("Expected the copied url, got %v", urls)
+	}
+
+	if urls, _ := watcher.Poll(); len(urls) != 0 {
+		t.Errorf("Expected nothing when the clipboard did not change, got %v", urls)
+	}
+
+	source.Set("some text", nil)
+	if urls, _ := watcher.Poll(); len(urls) != 0 {
+		t.Errorf("Expected nothing for text without urls, got %v", urls)
+	}
+
+	readErr := errors.New("no clipboard")
+	source.Set("", readErr)
+	if _, err := watcher.Poll(); !errors.Is(err, readErr) {
+		t.Errorf("Expected the read error, got %v", err)
+	}
+}
+
+func TestWatcher_Run(t *testing.T) {
+	source := &fakeSource{}
+	watcher := NewWatcher(source, nil)
+
+	found := make(chan []string, 1)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		watcher.Run(time.Millisecond, stop, func(urls []string) { found <- urls })
+		close(done)
+	}()
+
+	// the url must be copied after the watcher recorded the initial content
+	for source.Reads() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	source.Set("https://example.com/clip", nil)
+
+	select {
+	case urls := <-found:
+		if !slices.Equal(urls, []string{"https://example.com/clip"}) {
+			t.Errorf("Expected the copied url, got %v", urls)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the copied url to be found")
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Run to return once stopped")
+	}
+}
+
+func TestNewSource(t *testing.T) {
+	source, err := NewSource([]string{"echo", "-n", "https://example.com/clip"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	text, err := source.Read()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if text != "https://example.com/clip" {
+		t.Errorf("Expected the command output, got %q", text)
+	}
+
+	if _, err := (CommandSource{Name: "false"}).Read(); err == nil {
+		t.Error("Expected an error from a failing command")
+	}
+}
@@ -0,0 +1,31 @@
+package config
+
+import "errors"
+
+// API configures the embedded HTTP server controlling the downloads
+type API struct {
+	// Enabled starts the server along with the interface
+	Enabled bool `json:"enabled"`
+	// Listen is the address of the server, it should stay on localhost unless
+	// a reverse proxy terminating TLS sits in front of it
+	Listen string `json:"listen"`
+	// Token must be sent by clients as "Authorization: Bearer <token>"
+	Token string `json:"token"`
+}
+
+func DefaultAPI() API {
+	return API{Listen: "127.0.0.1:8642"}
+}
+
+func (a API) Validate() error {
+	if !a.Enabled {
+		return nil
+	}
+	if a.Listen == "" {
+		return errors.New("config: api listen must not be empty")
+	}
+	if a.Token == "" {
+		return errors.New("config: api token must not be empty")
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clipboard configures the watcher picking up the video urls copied to the
+// clipboard
+type Clipboard struct {
+	// Enabled starts watching the clipboard
+	Enabled bool `json:"enabled"`
+	// Command prints the clipboard content, such as ["wl-paste", "-n"], it is
+	// detected from the platform when empty
+	Command []string `json:"command"`
+	// Interval is how often the clipboard is read
+	Interval Duration `json:"interval"`
+	// AutoAdd queues the copied urls without asking first
+	AutoAdd bool `json:"auto_add"`
+	// Hosts are the sites whose urls are picked up, subdomains included. Any
+	// http or https url is picked up when empty.
+	Hosts []string `json:"hosts"`
+}
+
+func DefaultClipboard() Clipboard {
+	return Clipboard{
+		Interval: Duration(time.Second),
+		Hosts: []string{
+			"youtube.com", "youtu.be", "vimeo.com", "soundcloud.com", "twitch.tv",
+			"dailymotion.com", "bandcamp.com", "tiktok.com", "x.com", "twitter.com",
+		},
+	}
+}
+
+func (c Clipboard) Validate() error {
+	if c.Enabled && c.Interval <= 0 {
+		return fmt.Errorf("config: clipboard interval must be positive, got %v", time.Duration(c.Interval))
+	}
+	return nil
+}
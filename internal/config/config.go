@@ -0,0 +1,240 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const appName = "go-ytdlp-mngr"
+
+// EnvPath is the environment variable overriding the config file location
+const EnvPath = "YTDLP_MNGR_CONFIG"
+
+// Config describes how yt-dlp is invoked for every download
+type Config struct {
+	// Binary is the yt-dlp executable name or path
+	Binary string `json:"binary"`
+	// Args are passed to yt-dlp before the per item options and the url
+	Args []string `json:"args"`
+	// OutputDir is passed as --paths when not empty
+	OutputDir string `json:"output_dir"`
+	// OutputTemplate is passed as --output when not empty
+	OutputTemplate string `json:"output_template"`
+	// ArchiveFile is passed as --download-archive when not empty, the urls
+	// found in it are skipped without starting yt-dlp. Load defaults it to
+	// DefaultArchivePath.
+	ArchiveFile string `json:"archive_file"`
+	// Concurrency is the number of downloads running at the same time
+	Concurrency int `json:"concurrency"`
+	// PrefetchMetadata fetches the title and formats of every url when added
+	PrefetchMetadata bool `json:"prefetch_metadata"`
+	// SimulateOnAdd checks with yt-dlp --simulate that a url can be downloaded
+	// before the add form accepts it
+	SimulateOnAdd bool `json:"simulate_on_add"`
+	// LogLines is the number of output lines kept in memory per download
+	LogLines int `json:"log_lines"`
+	// LogDir is where the output of every download is written when not empty
+	LogDir string `json:"log_dir"`
+	// Clipboard configures queueing the urls copied to the clipboard
+	Clipboard Clipboard `json:"clipboard"`
+	// API configures the HTTP server controlling the downloads
+	API API `json:"api"`
+	// Retry is the retry policy of items whose profile does not define one
+	Retry Retry `json:"retry"`
+	// Profiles are the named option sets selectable when adding a url
+	Profiles []Profile `json:"profiles"`
+}
+
+// Profile is a named set of yt-dlp options, appended after Config.Args so
+// they take precedence over them
+type Profile struct {
+	Name  string   `json:"name"`
+	Args  []string `json:"args"`
+	Retry *Retry   `json:"retry,omitempty"`
+}
+
+func Default() Config {
+	return Config{
+		Binary:           "yt-dlp",
+		Args:             []string{"-f", "best[height<=1080]", "--fixup", "warn", "-4"},
+		Concurrency:      3,
+		PrefetchMetadata: true,
+		LogLines:         5000,
+		Clipboard:        DefaultClipboard(),
+		API:              DefaultAPI(),
+		Retry:            DefaultRetry(),
+		Profiles: []Profile{
+			{Name: "1080p video", Args: []string{"-f", "best[height<=1080]"}},
+			{Name: "audio mp3", Args: []string{"-f", "bestaudio", "-x", "--audio-format", "mp3"}},
+			{
+				Name: "archive best + subs",
+				Args: []string{"-f", "bestvideo+bestaudio/best", "--write-subs", "--embed-subs", "--embed-metadata"},
+			},
+		},
+	}
+}
+
+// Profile returns the profile with the given name
+func (c Config) Profile(name string) (Profile, bool) {
+	idx := slices.IndexFunc(c.Profiles, func(p Profile) bool { return p.Name == name })
+	if idx < 0 {
+		return Profile{}, false
+	}
+	return c.Profiles[idx], true
+}
+
+// RetryFor returns the retry policy of profile, falling back to Config.Retry
+func (c Config) RetryFor(profile Profile) Retry {
+	if profile.Retry != nil {
+		return *profile.Retry
+	}
+	return c.Retry
+}
+
+// DefaultPath returns the config file location following the XDG base
+// directory spec, $XDG_CONFIG_HOME falling back to ~/.config
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName, "config.json"), nil
+}
+
+// StateDir returns the directory of the files maintained by the manager,
+// following the XDG base directory spec, $XDG_STATE_HOME falling back to
+// ~/.local/state
+func StateDir() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, appName), nil
+}
+
+// DefaultArchivePath returns the download archive location used when the
+// config file does not set archive_file
+func DefaultArchivePath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "archive.txt"), nil
+}
+
+// Load reads the config file at path, fields missing from the file keep
+// their default value and a missing file yields Default(). The download
+// archive is kept in DefaultArchivePath unless the file names another one, or
+// disables it with an empty archive_file.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	archiveFile, err := DefaultArchivePath()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.ArchiveFile = archiveFile
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	cfg.OutputDir, err = ExpandHome(cfg.OutputDir)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.LogDir, err = ExpandHome(cfg.LogDir)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.ArchiveFile, err = ExpandHome(cfg.ArchiveFile)
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (c Config) Validate() error {
+	if c.Binary == "" {
+		return errors.New("config: binary must not be empty")
+	}
+	if c.Concurrency < 1 {
+		return fmt.Errorf("config: concurrency must be at least 1, got %d", c.Concurrency)
+	}
+	if c.LogLines < 1 {
+		return fmt.Errorf("config: log_lines must be at least 1, got %d", c.LogLines)
+	}
+
+	if err := c.Clipboard.Validate(); err != nil {
+		return err
+	}
+	if err := c.API.Validate(); err != nil {
+		return err
+	}
+	if err := c.Retry.Validate(); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(c.Profiles))
+	for _, profile := range c.Profiles {
+		if profile.Name == "" {
+			return errors.New("config: profile name must not be empty")
+		}
+		if profile.Retry != nil {
+			if err := profile.Retry.Validate(); err != nil {
+				return fmt.Errorf("profile %q: %w", profile.Name, err)
+			}
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("config: duplicate profile %q", profile.Name)
+		}
+		names[profile.Name] = true
+	}
+	return nil
+}
+
+// CommandArgs returns the yt-dlp arguments shared by every download
+func (c Config) CommandArgs() []string {
+	args := slices.Clone(c.Args)
+	if c.OutputDir != "" {
+		args = append(args, "--paths", c.OutputDir)
+	}
+	if c.OutputTemplate != "" {
+		args = append(args, "--output", c.OutputTemplate)
+	}
+	if c.ArchiveFile != "" {
+		args = append(args, "--download-archive", c.ArchiveFile)
+	}
+	return args
+}
+
+// ExpandHome replaces a leading ~ in path with the home directory of the user
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
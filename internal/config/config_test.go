@@ -0,0 +1,210 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("missing_file", func(t *testing.T) {
+		t.Setenv("XDG_STATE_HOME", "/tmp/state")
+
+		cfg, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if cfg.Binary != "yt-dlp" || cfg.Concurrency != 3 {
+			t.Errorf("Expected defaults, got %+v", cfg)
+		}
+		if cfg.ArchiveFile != "/tmp/state/go-ytdlp-mngr/archive.txt" {
+			t.Errorf("Expected the default archive, got '%s'", cfg.ArchiveFile)
+		}
+	})
+
+	t.Run("archive_file", func(t *testing.T) {
+		t.Setenv("HOME", "/home/test")
+
+		cfg, err := Load(writeConfig(t, `{"archive_file": "~/Videos/archive.txt"}`))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if cfg.ArchiveFile != "/home/test/Videos/archive.txt" {
+			t.Errorf("Expected the configured archive, got '%s'", cfg.ArchiveFile)
+		}
+
+		if cfg, err = Load(writeConfig(t, `{"archive_file": ""}`)); err != nil || cfg.ArchiveFile != "" {
+			t.Errorf("Expected the archive to be disabled, got '%s' (%v)", cfg.ArchiveFile, err)
+		}
+	})
+
+	t.Run("partial_file", func(t *testing.T) {
+		t.Setenv("HOME", "/home/test")
+		path := writeConfig(t, `{"binary": "/opt/yt-dlp", "output_dir": "~/Videos", "log_dir": "~/logs"}`)
+
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if cfg.Binary != "/opt/yt-dlp" {
+			t.Errorf("Expected binary '/opt/yt-dlp', got '%s'", cfg.Binary)
+		}
+		if cfg.OutputDir != "/home/test/Videos" {
+			t.Errorf("Expected expanded output dir, got '%s'", cfg.OutputDir)
+		}
+		if cfg.LogDir != "/home/test/logs" {
+			t.Errorf("Expected expanded log dir, got '%s'", cfg.LogDir)
+		}
+		if !slices.Equal(cfg.Args, Default().Args) {
+			t.Errorf("Expected default args, got %v", cfg.Args)
+		}
+	})
+
+	t.Run("invalid_values", func(t *testing.T) {
+		for _, content := range []string{
+			`{"concurrency": 0}`,
+			`{"log_lines": 0}`,
+			`{"clipboard": {"enabled": true, "interval": "0s"}}`,
+			`{"api": {"enabled": true}}`,
+		} {
+			path := writeConfig(t, content)
+			if _, err := Load(path); err == nil {
+				t.Errorf("Expected validation error for %s", content)
+			}
+		}
+	})
+
+	t.Run("clipboard", func(t *testing.T) {
+		path := writeConfig(t, `{"clipboard": {"enabled": true, "command": ["xsel", "-bo"]}}`)
+
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !cfg.Clipboard.Enabled || !slices.Equal(cfg.Clipboard.Command, []string{"xsel", "-bo"}) {
+			t.Errorf("Expected the clipboard command to be read, got %+v", cfg.Clipboard)
+		}
+		if cfg.Clipboard.Interval != Duration(time.Second) || len(cfg.Clipboard.Hosts) == 0 {
+			t.Errorf("Expected the default interval and hosts, got %+v", cfg.Clipboard)
+		}
+	})
+
+	t.Run("invalid_json", func(t *testing.T) {
+		path := writeConfig(t, `{`)
+		if _, err := Load(path); err == nil {
+			t.Error("Expected parse error")
+		}
+	})
+}
+
+func TestConfig_CommandArgs(t *testing.T) {
+	cfg := Config{
+		Binary:         "yt-dlp",
+		Args:           []string{"-x"},
+		OutputDir:      "/downloads",
+		OutputTemplate: "%(title)s.%(ext)s",
+		ArchiveFile:    "/downloads/archive.txt",
+	}
+
+	expected := []string{
+		"-x", "--paths", "/downloads", "--output", "%(title)s.%(ext)s",
+		"--download-archive", "/downloads/archive.txt",
+	}
+	if args := cfg.CommandArgs(); !slices.Equal(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+}
+
+func TestConfig_Profiles(t *testing.T) {
+	t.Run("lookup", func(t *testing.T) {
+		cfg := Default()
+
+		profile, ok := cfg.Profile("audio mp3")
+		if !ok {
+			t.Fatal("Expected default 'audio mp3' profile")
+		}
+		if !slices.Contains(profile.Args, "-x") {
+			t.Errorf("Expected audio profile to extract audio, got %v", profile.Args)
+		}
+
+		if _, ok := cfg.Profile("missing"); ok {
+			t.Error("Expected unknown profile lookup to fail")
+		}
+	})
+
+	t.Run("from_file", func(t *testing.T) {
+		path := writeConfig(t, `{"profiles": [{"name": "4k", "args": ["-f", "bv*[height<=2160]+ba"]}]}`)
+
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(cfg.Profiles) != 1 || cfg.Profiles[0].Name != "4k" {
+			t.Errorf("Expected profiles to be replaced, got %+v", cfg.Profiles)
+		}
+	})
+
+	t.Run("duplicate_names", func(t *testing.T) {
+		path := writeConfig(t, `{"profiles": [{"name": "a"}, {"name": "a"}]}`)
+		if _, err := Load(path); err == nil {
+			t.Error("Expected duplicate profile error")
+		}
+	})
+}
+
+func TestConfig_Retry(t *testing.T) {
+	t.Run("profile_override", func(t *testing.T) {
+		path := writeConfig(t, `{
+			"retry": {"max_attempts": 5, "initial_backoff": "1s", "max_backoff": "1m", "multiplier": 3},
+			"profiles": [
+				{"name": "default"},
+				{"name": "flaky", "retry": {"max_attempts": 10, "initial_backoff": "30s", "max_backoff": "1h", "multiplier": 2, "exit_codes": [1]}}
+			]
+		}`)
+
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if cfg.Retry.MaxAttempts != 5 || time.Duration(cfg.Retry.InitialBackoff) != time.Second {
+			t.Errorf("Unexpected global retry %+v", cfg.Retry)
+		}
+
+		profile, _ := cfg.Profile("default")
+		if cfg.RetryFor(profile).MaxAttempts != 5 {
+			t.Errorf("Expected profile without retry to use the global policy")
+		}
+
+		profile, _ = cfg.Profile("flaky")
+		retry := cfg.RetryFor(profile)
+		if retry.MaxAttempts != 10 || !slices.Equal(retry.ExitCodes, []int{1}) {
+			t.Errorf("Expected profile retry policy, got %+v", retry)
+		}
+	})
+
+	t.Run("invalid_pattern", func(t *testing.T) {
+		path := writeConfig(t, `{"retry": {"max_attempts": 2, "multiplier": 2, "stderr_patterns": ["("]}}`)
+		if _, err := Load(path); err == nil {
+			t.Error("Expected invalid pattern error")
+		}
+	})
+
+	t.Run("invalid_duration", func(t *testing.T) {
+		path := writeConfig(t, `{"retry": {"initial_backoff": "soon"}}`)
+		if _, err := Load(path); err == nil {
+			t.Error("Expected invalid duration error")
+		}
+	})
+}
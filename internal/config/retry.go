@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Duration is a time.Duration read from strings such as "30s" or "5m"
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Retry configures how failed downloads are retried. A failure is retryable
+// when the exit code is listed in ExitCodes or a stderr line matches one of
+// the StderrPatterns.
+type Retry struct {
+	// MaxAttempts is the total number of attempts, 1 disables retries
+	MaxAttempts    int      `json:"max_attempts"`
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
+	Multiplier     float64  `json:"multiplier"`
+	ExitCodes      []int    `json:"exit_codes"`
+	StderrPatterns []string `json:"stderr_patterns"`
+}
+
+func DefaultRetry() Retry {
+	return Retry{
+		MaxAttempts:    3,
+		InitialBackoff: Duration(10 * time.Second),
+		MaxBackoff:     Duration(5 * time.Minute),
+		Multiplier:     2,
+		StderrPatterns: []string{
+			`HTTP Error 5\d\d`,
+			`HTTP Error 429`,
+			`(?i)timed out`,
+			`(?i)connection (reset|refused|aborted)`,
+			`(?i)temporary failure in name resolution`,
+			`IncompleteRead`,
+			`Unable to download (webpage|video data|JSON metadata)`,
+		},
+	}
+}
+
+func (r Retry) Validate() error {
+	if r.MaxAttempts < 1 {
+		return fmt.Errorf("config: retry max_attempts must be at least 1, got %d", r.MaxAttempts)
+	}
+	if r.InitialBackoff < 0 || r.MaxBackoff < 0 {
+		return fmt.Errorf("config: retry backoff must not be negative")
+	}
+	if r.Multiplier < 1 {
+		return fmt.Errorf("config: retry multiplier must be at least 1, got %v", r.Multiplier)
+	}
+	for _, pattern := range r.StderrPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("config: retry stderr pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,598 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/api"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+// requestTimeout bounds the requests sent to the daemon, the event stream
+// is not bounded
+const requestTimeout = 10 * time.Second
+
+// reconnectDelay is how long the client waits before following the events
+// of the daemon again after losing them
+const reconnectDelay = time.Second
+
+// Client drives the downloads of a daemon through its socket. The items of
+// the daemon are mirrored as url items which the event stream keeps up to
+// date, and the changes are published on a local bus, so they are listed
+// like the items of a local queue.
+type Client struct {
+	http     *http.Client
+	stream   *http.Client
+	base     string
+	config   config.Config
+	executor url.CommandExecutor
+	events   *url.Bus
+
+	mutex      sync.Mutex
+	items      []*url.UrlItem
+	byID       map[string]*url.UrlItem
+	logsLoaded map[string]bool
+	// pendingLogs holds the lines streamed while the logs of an item load
+	pendingLogs map[string][]url.LogLine
+	concurrency int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Dial connects to the daemon listening on the unix socket at path, items
+// prepared for it use cfg and executor
+func Dial(path string, cfg config.Config, executor url.CommandExecutor) (*Client, error) {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}
+	return NewClient(&http.Client{Transport: transport}, "http://daemon", cfg, executor)
+}
+
+// NewClient follows the daemon served at base through httpClient, whose
+// timeout must be unset since the event stream never ends
+func NewClient(httpClient *http.Client, base string, cfg config.Config, executor url.CommandExecutor) (*Client, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		http:        &http.Client{Transport: httpClient.Transport, Timeout: requestTimeout},
+		stream:      httpClient,
+		base:        strings.TrimSuffix(base, "/"),
+		config:      cfg,
+		executor:    executor,
+		events:      url.NewBus(),
+		byID:        make(map[string]*url.UrlItem),
+		logsLoaded:  make(map[string]bool),
+		pendingLogs: make(map[string][]url.LogLine),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+
+	// the stream is opened first so no change is missed after the refresh
+	body, err := c.openStream(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := c.refresh(); err != nil {
+		body.Close()
+		cancel()
+		return nil, err
+	}
+
+	go c.follow(ctx, body)
+	return c, nil
+}
+
+// Close stops following the daemon, its downloads carry on
+func (c *Client) Close() {
+	c.cancel()
+	<-c.done
+}
+
+func (c *Client) Events() *url.Bus {
+	return c.events
+}
+
+// Items returns the mirrors of the items of the daemon in queue order
+func (c *Client) Items() []*url.UrlItem {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return slices.Clone(c.items)
+}
+
+// Find returns the item downloading the same video as rawUrl, or nil
+func (c *Client) Find(rawUrl string) *url.UrlItem {
+	return url.FindUrl(c.Items(), rawUrl)
+}
+
+// Get returns the mirror of the item with the given id, or nil
+func (c *Client) Get(id string) *url.UrlItem {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.byID[id]
+}
+
+// BatchItems prepares the items of the valid entries which are not listed by
+// the daemon, they are sent to it by Add
+func (c *Client) BatchItems(entries []url.BatchEntry, cfg config.Config, profile config.Profile, executor url.CommandExecutor) ([]*url.UrlItem, []error) {
+	return url.NewBatchItems(entries, c.Find, cfg, profile, executor)
+}
+
+// Add sends items to the daemon, they are listed by their mirrors once added
+func (c *Client) Add(items ...*url.UrlItem) {
+	if _, err := c.AddItems(items...); err != nil {
+		log.Println(err)
+	}
+}
+
+// AddItems sends items to the daemon and returns their mirrors, the items
+// the daemon refused are reported in the error
+func (c *Client) AddItems(items ...*url.UrlItem) ([]*url.UrlItem, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	request := api.AddRequest{Items: make([]api.AddItem, 0, len(items))}
+	for _, item := range items {
+		spec := api.AddItem{
+			Url:      item.Url,
+			Profile:  item.Profile.Name,
+			Format:   item.Format(),
+			Metadata: item.Metadata(),
+		}
+		if item.Group.Url != "" {
+			group := item.Group
+			spec.Group = &group
+		}
+		request.Items = append(request.Items, spec)
+	}
+
+	var response api.AddResponse
+	if err := c.do(http.MethodPost, "/api/items", request, &response); err != nil {
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.Status != http.StatusUnprocessableEntity {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for _, skipped := range response.Skipped {
+		errs = append(errs, fmt.Errorf("could not add %s: %s", skipped.Url, skipped.Error))
+	}
+	mirrors := make([]*url.UrlItem, 0, len(response.Items))
+	for _, added := range response.Items {
+		// the stream may have reported it already, with a newer state
+		if c.Get(added.ID) == nil {
+			c.apply(added, url.Event{Type: url.EventAdded})
+		}
+		if mirror := c.Get(added.ID); mirror != nil {
+			mirrors = append(mirrors, mirror)
+		}
+	}
+	return mirrors, errors.Join(errs...)
+}
+
+func (c *Client) Remove(item *url.UrlItem) {
+	if err := c.RemoveItem(item); err != nil {
+		log.Println(err)
+	}
+}
+
+// RemoveItem removes item from the daemon, stopping its download
+func (c *Client) RemoveItem(item *url.UrlItem) error {
+	if err := c.do(http.MethodDelete, "/api/items/"+item.ID(), nil, nil); err != nil {
+		return err
+	}
+	c.forget(item.ID())
+	return nil
+}
+
+// RemoveCompleted removes the completed and archived items
+func (c *Client) RemoveCompleted() {
+	if err := c.do(http.MethodPost, "/api/queue/clear", nil, nil); err != nil {
+		log.Println(err)
+	}
+	c.resync()
+}
+
+// SortByComplete moves the completed items to the end of the list
+func (c *Client) SortByComplete() {
+	if err := c.do(http.MethodPost, "/api/queue/sort", nil, nil); err != nil {
+		log.Println(err)
+	}
+	c.resync()
+}
+
+// Move shifts a queued item by delta positions among the queued items
+func (c *Client) Move(item *url.UrlItem, delta int) {
+	if err := c.do(http.MethodPost, "/api/items/"+item.ID()+"/move", api.MoveRequest{Delta: delta}, nil); err != nil {
+		log.Println(err)
+	}
+	c.resync()
+}
+
+// Pause stops a running or queued item, reporting whether it was eligible
+func (c *Client) Pause(item *url.UrlItem) bool {
+	return c.action(item, "pause")
+}
+
+// Resume queues a paused item again, reporting whether it was eligible
+func (c *Client) Resume(item *url.UrlItem) bool {
+	return c.action(item, "resume")
+}
+
+// Retry queues a failed item again, reporting whether it was eligible
+func (c *Client) Retry(item *url.UrlItem) bool {
+	return c.action(item, "retry")
+}
+
+func (c *Client) action(item *url.UrlItem, name string) bool {
+	err := c.do(http.MethodPost, "/api/items/"+item.ID()+"/"+name, nil, nil)
+	var statusErr *StatusError
+	if err != nil && !(errors.As(err, &statusErr) && statusErr.Status == http.StatusConflict) {
+		log.Println(err)
+	}
+	return err == nil
+}
+
+// SetFormat picks the formats downloaded by the next start of item
+func (c *Client) SetFormat(item *url.UrlItem, choice url.FormatChoice) {
+	item.SetFormat(choice)
+	if err := c.do(http.MethodPut, "/api/items/"+item.ID()+"/format", choice, nil); err != nil {
+		log.Println(err)
+	}
+}
+
+// Logs returns the output of item, the lines recorded by the daemon before
+// the first call are loaded then. Calls made meanwhile return the buffer
+// right away, the lines are inserted in it once loaded.
+func (c *Client) Logs(item *url.UrlItem) *url.LogBuffer {
+	id := item.ID()
+	c.mutex.Lock()
+	_, loading := c.pendingLogs[id]
+	if c.logsLoaded[id] || loading {
+		// a call still loading them fills the buffer
+		c.mutex.Unlock()
+		return item.Logs()
+	}
+	c.pendingLogs[id] = nil
+	c.mutex.Unlock()
+
+	var response api.LogsResponse
+	err := c.do(http.MethodGet, "/api/items/"+id+"/logs", nil, &response)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	pending := c.pendingLogs[id]
+	delete(c.pendingLogs, id)
+	if err != nil {
+		log.Println(err)
+		return item.Logs()
+	}
+
+	for _, line := range response.Lines {
+		item.Logs().Insert(line.Line())
+	}
+	for _, line := range pending {
+		item.Logs().Insert(line)
+	}
+	c.logsLoaded[id] = true
+	return item.Logs()
+}
+
+// Concurrency returns how many downloads the daemon runs at the same time
+func (c *Client) Concurrency() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.concurrency
+}
+
+func (c *Client) SetConcurrency(n int) {
+	var info api.QueueInfo
+	if err := c.do(http.MethodPut, "/api/queue", api.QueueInfo{Concurrency: max(n, 1)}, &info); err != nil {
+		log.Println(err)
+		return
+	}
+
+	c.mutex.Lock()
+	c.concurrency = info.Concurrency
+	c.mutex.Unlock()
+}
+
+// StatusError is a response of the daemon reporting a failure
+type StatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("daemon: %s (%d)", e.Message, e.Status)
+}
+
+// do sends request as JSON and decodes the response into response, both may
+// be nil
+func (c *Client) do(method string, path string, request any, response any) error {
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&failure); err != nil || failure.Error == "" {
+			failure.Error = http.StatusText(resp.StatusCode)
+		}
+		return &StatusError{Status: resp.StatusCode, Message: failure.Error}
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// refresh replaces the mirrors with the items listed by the daemon, changes
+// are published as events
+func (c *Client) refresh() error {
+	var items []api.Item
+	if err := c.do(http.MethodGet, "/api/items", nil, &items); err != nil {
+		return err
+	}
+	var info api.QueueInfo
+	if err := c.do(http.MethodGet, "/api/queue", nil, &info); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.concurrency = info.Concurrency
+	listed := make(map[string]bool, len(items))
+	for _, item := range items {
+		listed[item.ID] = true
+	}
+	var gone []*url.UrlItem
+	for id, mirror := range c.byID {
+		if !listed[id] {
+			gone = append(gone, mirror)
+		}
+	}
+	c.mutex.Unlock()
+
+	for _, mirror := range gone {
+		c.forget(mirror.ID())
+	}
+	for _, item := range items {
+		c.apply(item, url.Event{Type: url.EventStageChanged})
+	}
+
+	// the order may have changed as well
+	c.mutex.Lock()
+	ordered := make([]*url.UrlItem, 0, len(items))
+	for _, item := range items {
+		if mirror, ok := c.byID[item.ID]; ok {
+			ordered = append(ordered, mirror)
+		}
+	}
+	c.items = ordered
+	c.mutex.Unlock()
+	return nil
+}
+
+// resync refreshes the mirrors after a change which is not reported by an
+// event, such as a new order
+func (c *Client) resync() {
+	if err := c.refresh(); err != nil {
+		log.Println(err)
+	}
+}
+
+// apply updates the mirror of item, creating it when unknown, and publishes
+// event for it. Stage changes are only published when the stage changed.
+func (c *Client) apply(item api.Item, event url.Event) {
+	c.mutex.Lock()
+	mirror, ok := c.byID[item.ID]
+	if !ok {
+		var err error
+		mirror, err = url.NewMirrorItem(item.ID, item.State(), item.DownloadProgress(), c.config, c.executor)
+		if err != nil {
+			c.mutex.Unlock()
+			log.Println(err)
+			return
+		}
+		c.byID[item.ID] = mirror
+		c.items = append(c.items, mirror)
+		c.mutex.Unlock()
+
+		c.events.Publish(url.Event{Type: url.EventAdded, Item: mirror})
+		return
+	}
+	c.mutex.Unlock()
+
+	from := mirror.Stage()
+	mirror.Sync(item.State(), item.DownloadProgress())
+
+	if event.Type == url.EventAdded {
+		return
+	}
+	if event.Type == url.EventStageChanged {
+		if from == item.Stage {
+			return
+		}
+		event.From, event.To = from, item.Stage
+	}
+	event.Item = mirror
+	event.Progress = mirror.Progress()
+	event.Failure = mirror.Failure()
+	c.events.Publish(event)
+}
+
+// forget drops the mirror of the item with the given id
+func (c *Client) forget(id string) {
+	c.mutex.Lock()
+	mirror, ok := c.byID[id]
+	if ok {
+		delete(c.byID, id)
+		delete(c.logsLoaded, id)
+		delete(c.pendingLogs, id)
+		c.items = slices.DeleteFunc(c.items, func(item *url.UrlItem) bool {
+			return item == mirror
+		})
+	}
+	c.mutex.Unlock()
+
+	if ok {
+		c.events.Publish(url.Event{Type: url.EventRemoved, Item: mirror})
+	}
+}
+
+// openStream starts following every event of the daemon, log lines included
+func (c *Client) openStream(ctx context.Context) (io.ReadCloser, error) {
+	types := make([]string, 0, 9)
+	for eventType := url.EventAdded; eventType <= url.EventMetadata; eventType++ {
+		types = append(types, eventType.String())
+	}
+	query := neturl.Values{"type": {strings.Join(types, ",")}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/api/events?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.stream.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &StatusError{Status: resp.StatusCode, Message: "could not follow the events"}
+	}
+	return resp.Body, nil
+}
+
+// follow applies the events of the stream, reconnecting until ctx is done.
+// The mirrors are refreshed after reconnecting since events were missed.
+func (c *Client) follow(ctx context.Context, body io.ReadCloser) {
+	defer close(c.done)
+
+	for {
+		err := c.read(body)
+		body.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("lost the events of the daemon: %v", err)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(reconnectDelay):
+			}
+			if body, err = c.openStream(ctx); err != nil {
+				continue
+			}
+			if err = c.refresh(); err != nil {
+				body.Close()
+				continue
+			}
+			break
+		}
+	}
+}
+
+// read parses the Server-Sent Events of body until it ends
+func (c *Client) read(body io.Reader) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var name string
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if name == "reset" {
+				// the events since the last one received are lost
+				c.resync()
+			} else if len(data) > 0 {
+				c.handle(data)
+			}
+			name, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+func (c *Client) handle(data []byte) {
+	var event api.StreamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		log.Printf("invalid event from the daemon: %v", err)
+		return
+	}
+
+	switch event.Type {
+	case url.EventRemoved:
+		c.forget(event.ItemID)
+	case url.EventLogLine:
+		mirror := c.Get(event.ItemID)
+		if mirror == nil || event.Log == nil {
+			return
+		}
+		line := event.Log.Line()
+
+		// the earlier lines are only fetched when the logs are first shown
+		c.mutex.Lock()
+		loaded := c.logsLoaded[event.ItemID]
+		if pending, loading := c.pendingLogs[event.ItemID]; loading {
+			c.pendingLogs[event.ItemID] = append(pending, line)
+		}
+		c.mutex.Unlock()
+
+		if loaded && mirror.Logs().Insert(line) {
+			c.events.Publish(url.Event{Type: url.EventLogLine, Item: mirror, At: event.At, Log: line})
+		}
+	default:
+		c.apply(event.Item, url.Event{Type: event.Type, At: event.At})
+	}
+}
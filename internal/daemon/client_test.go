@@ -0,0 +1,120 @@
+package daemon
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/storage"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/testutil"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+func dialDaemon(t *testing.T, wait time.Duration) *Client {
+	t.Helper()
+
+	socketPath, _ := startDaemon(t, storage.NewFileStorage(filepath.Join(t.TempDir(), "downloads.json")), wait)
+	client, err := Dial(socketPath, testConfig(), url.NewMockCommandExecutor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestClient_Mirror(t *testing.T) {
+	client := dialDaemon(t, 100*time.Millisecond)
+	events, unsubscribe := client.Events().Subscribe(url.EventAdded, url.EventStageChanged, url.EventFinished)
+	defer unsubscribe()
+
+	item := url.NewUrlItem("https://example.com/video")
+	item.SetFormat(url.FormatChoice{Video: "137", Audio: "140"})
+	client.Add(item)
+
+	mirror := client.Find("https://example.com/video")
+	if mirror == nil {
+		t.Fatal("Expected the added item to be listed once added")
+	}
+	if mirror == item || mirror.ID() == "" {
+		t.Errorf("Expected a mirror of the item of the daemon, got %+v", mirror)
+	}
+	if mirror.Format().Selector() != "137+140" {
+		t.Errorf("Expected the format to be sent along, got %q", mirror.Format().Selector())
+	}
+
+	var seen []url.EventType
+	timeout := time.After(2 * time.Second)
+	for len(seen) == 0 || seen[len(seen)-1] != url.EventFinished {
+		select {
+		case event := <-events:
+			if event.Item != mirror {
+				t.Fatalf("Expected the events to carry the mirror, got %+v", event.Item)
+			}
+			seen = append(seen, event.Type)
+		case <-timeout:
+			t.Fatalf("Expected the download to finish, got the events %v", seen)
+		}
+	}
+	if mirror.Stage() != url.StageCompleted || mirror.StoppedAt().IsZero() {
+		t.Errorf("Expected the mirror to be completed, got %s", mirror.Stage())
+	}
+
+	lines := client.Logs(mirror).Lines()
+	if len(lines) != 2 || lines[1].Text != "[download] Destination: video.mp4" {
+		t.Errorf("Expected the output of the daemon, got %+v", lines)
+	}
+
+	client.Remove(mirror)
+	if len(client.Items()) != 0 {
+		t.Errorf("Expected the item to be removed, got %d items", len(client.Items()))
+	}
+}
+
+func TestClient_Queue(t *testing.T) {
+	client := dialDaemon(t, time.Second)
+
+	client.SetConcurrency(0)
+	if client.Concurrency() != 1 {
+		t.Fatalf("Expected a concurrency of 1, got %d", client.Concurrency())
+	}
+
+	for _, rawUrl := range []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"} {
+		client.Add(url.NewUrlItem(rawUrl))
+	}
+	first, last := client.Items()[0], client.Items()[2]
+	testutil.WaitFor(t, "the first item to start", func() bool {
+		return first.Stage() == url.StageDownloading
+	})
+
+	client.Move(last, -1)
+	if urls := itemUrls(client.Items()); urls[1] != "https://example.com/c" {
+		t.Errorf("Expected the last item to move up, got %v", urls)
+	}
+
+	if !client.Pause(last) {
+		t.Fatal("Expected the queued item to pause")
+	}
+	testutil.WaitFor(t, "the mirror to pause", func() bool {
+		return last.Stage() == url.StagePaused
+	})
+	if client.Pause(last) {
+		t.Error("Expected a paused item not to pause again")
+	}
+	if !client.Resume(last) {
+		t.Error("Expected the paused item to resume")
+	}
+}
+
+func TestClient_Dial(t *testing.T) {
+	if _, err := Dial(filepath.Join(t.TempDir(), "missing.sock"), testConfig(), url.NewMockCommandExecutor()); err == nil {
+		t.Error("Expected an error without a daemon")
+	}
+}
+
+func itemUrls(items []*url.UrlItem) []string {
+	urls := make([]string, 0, len(items))
+	for _, item := range items {
+		urls = append(urls, item.Url)
+	}
+	return urls
+}
@@ -0,0 +1,105 @@
+// Package daemon runs the download queue in the background, serving it on
+// a unix socket to which the interface attaches as a client
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/api"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/storage"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+// shutdownTimeout bounds the time given to the clients to disconnect
+const shutdownTimeout = 5 * time.Second
+
+// DefaultSocketPath returns the socket location, in $XDG_RUNTIME_DIR when set
+// and next to the state file otherwise
+func DefaultSocketPath() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "go-ytdlp-mngr.sock"), nil
+	}
+
+	statePath, err := storage.DefaultStatePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(statePath), "daemon.sock"), nil
+}
+
+// Running tells whether a daemon is listening on the socket at path
+func Running(path string) bool {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Run downloads the items saved in store until ctx is done, serving them on
+// the unix socket at socketPath, and on the address of the config when the
+// API is enabled. The state is saved as the items change and before
+// returning, the running downloads are stopped then to resume on the next
+// run.
+func Run(ctx context.Context, cfg config.Config, store storage.Storage, socketPath string, executor url.CommandExecutor) error {
+	unlock, err := store.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	queue := url.NewQueue(cfg.Concurrency)
+	queue.ApplyConfig(cfg)
+
+	items, err := storage.LoadItems(store, cfg, executor)
+	if err != nil {
+		return err
+	}
+	queue.Restore(items...)
+
+	apiServer := api.NewServer(queue, cfg, executor)
+	servers := make([]*http.Server, 0, 2)
+
+	server, err := apiServer.ListenUnix(socketPath)
+	if err != nil {
+		apiServer.Close()
+		queue.StopAll()
+		return err
+	}
+	servers = append(servers, server)
+	log.Printf("listening on %s", socketPath)
+
+	if cfg.API.Enabled {
+		server, err := apiServer.Listen(cfg.API.Listen)
+		if err != nil {
+			log.Printf("could not start the api: %v", err)
+		} else {
+			servers = append(servers, server)
+			log.Printf("api listening on %s", cfg.API.Listen)
+		}
+	}
+
+	storage.SaveOnChange(ctx, queue, store)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			log.Println(err)
+		}
+	}
+
+	// save before stopping so interrupted downloads are resumed on the next run
+	err = storage.SaveItems(store, queue.Items())
+	queue.StopAll()
+	return err
+}
@@ -0,0 +1,123 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/storage"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/testutil"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+func testConfig() config.Config {
+	cfg := config.Default()
+	cfg.PrefetchMetadata = false
+	return cfg
+}
+
+const testOutput = "[info] Downloading\n[download] Destination: video.mp4\n"
+
+// startDaemon runs a daemon over store until the test ends, returning the
+// path of its socket and a function stopping it early
+func startDaemon(t *testing.T, store storage.Storage, wait time.Duration) (string, func() error) {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- Run(ctx, testConfig(), store, socketPath, url.NewMockDownloadExecutor(wait, testOutput))
+	}()
+
+	stop := func() error {
+		cancel()
+		select {
+		case err := <-result:
+			result <- err
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the daemon to stop")
+			return nil
+		}
+	}
+	t.Cleanup(func() { stop() })
+
+	testutil.WaitFor(t, "the daemon to listen on its socket", func() bool {
+		return Running(socketPath)
+	})
+	return socketPath, stop
+}
+
+func TestRun(t *testing.T) {
+	store := storage.NewFileStorage(filepath.Join(t.TempDir(), "downloads.json"))
+	if err := store.Save([]url.ItemState{
+		{Url: "https://example.com/saved", Stage: url.StageCompleted},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	socketPath, stop := startDaemon(t, store, 50*time.Millisecond)
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		t.Errorf("Expected the socket to be private, got %v", perm)
+	}
+
+	client, err := Dial(socketPath, testConfig(), url.NewMockCommandExecutor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Add(url.NewUrlItem("https://example.com/added"))
+	testutil.WaitFor(t, "the added item to complete", func() bool {
+		item := client.Find("https://example.com/added")
+		return item != nil && item.Stage() == url.StageCompleted
+	})
+	client.Close()
+
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if Running(socketPath) {
+		t.Error("Expected the socket to be closed")
+	}
+
+	states, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || states[0].Url != "https://example.com/saved" || states[1].Stage != url.StageCompleted {
+		t.Errorf("Expected the added item to be saved, got %+v", states)
+	}
+}
+
+func TestRun_SocketInUse(t *testing.T) {
+	socketPath, _ := startDaemon(t, storage.NewFileStorage(filepath.Join(t.TempDir(), "downloads.json")), time.Millisecond)
+
+	err := Run(context.Background(), testConfig(), storage.NewFileStorage(filepath.Join(t.TempDir(), "other.json")), socketPath, url.NewMockDownloadExecutor(time.Millisecond, testOutput))
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("Expected a second daemon to be refused, got %v", err)
+	}
+}
+
+func TestRun_StoreLocked(t *testing.T) {
+	store := storage.NewFileStorage(filepath.Join(t.TempDir(), "downloads.json"))
+	unlock, err := store.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	err = Run(context.Background(), testConfig(), store, filepath.Join(t.TempDir(), "daemon.sock"), url.NewMockDownloadExecutor(time.Millisecond, testOutput))
+	if !errors.Is(err, storage.ErrLocked) {
+		t.Errorf("Expected a list used by another process to be refused, got %v", err)
+	}
+}
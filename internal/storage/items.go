@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+// saveDelay coalesces the changes of a queue into a single save
+const saveDelay = time.Second
+
+// LoadItems rebuilds the items saved in store, downloading with cfg
+func LoadItems(store Storage, cfg config.Config, executor url.CommandExecutor) ([]*url.UrlItem, error) {
+	states, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*url.UrlItem, 0, len(states))
+	for _, state := range states {
+		item, err := url.NewUrlItemFromState(state, cfg, executor)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// SaveItems persists the state of items in store
+func SaveItems(store Storage, items []*url.UrlItem) error {
+	states := make([]url.ItemState, 0, len(items))
+	for _, item := range items {
+		states = append(states, item.State())
+	}
+	return store.Save(states)
+}
+
+// SaveOnChange saves the items of queue in store shortly after they change,
+// so the stages are kept when the process is killed, until ctx is done
+func SaveOnChange(ctx context.Context, queue *url.Queue, store Storage) {
+	events, unsubscribe := queue.Events().Subscribe(
+		url.EventAdded, url.EventStarted, url.EventStageChanged, url.EventFinished,
+		url.EventFailed, url.EventRemoved, url.EventMetadata,
+	)
+	defer unsubscribe()
+
+	timer := time.NewTimer(saveDelay)
+	timer.Stop()
+	pending := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-events:
+			if !pending {
+				pending = true
+				timer.Reset(saveDelay)
+			}
+		case <-timer.C:
+			pending = false
+			if err := SaveItems(store, queue.Items()); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
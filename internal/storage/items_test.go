@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+func TestSaveOnChange(t *testing.T) {
+	store := NewFileStorage(filepath.Join(t.TempDir(), "downloads.json"))
+	queue := url.NewQueue(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		SaveOnChange(ctx, queue, store)
+		close(done)
+	}()
+
+	// subscribing races with the first change, so the items are restored
+	// until one is saved
+	deadline := time.Now().Add(3 * saveDelay)
+	for {
+		queue.Restore(url.NewUrlItemEx("https://example.com/video", url.NewMockCommandExecutor()))
+		time.Sleep(saveDelay + 100*time.Millisecond)
+
+		states, err := store.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(states) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the restored items to be saved")
+		}
+	}
+
+	cancel()
+	<-done
+}
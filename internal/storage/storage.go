@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+const stateVersion = 1
+
+// ErrLocked is returned by Lock when another process runs the downloads of
+// the list
+var ErrLocked = errors.New("the download list is in use by another process")
+
+// Storage defines the interface for persisting the download list
+type Storage interface {
+	Load() ([]url.ItemState, error)
+	Save(items []url.ItemState) error
+	// Lock claims the list for the process running its downloads, until
+	// unlock is called
+	Lock() (unlock func() error, err error)
+}
+
+// FileStorage implements Storage with a JSON state file
+type FileStorage struct {
+	path string
+}
+
+type stateFile struct {
+	Version int             `json:"version"`
+	Items   []url.ItemState `json:"items"`
+}
+
+func NewFileStorage(path string) *FileStorage {
+	return &FileStorage{path: path}
+}
+
+// DefaultStatePath returns the state file location, in config.StateDir
+func DefaultStatePath() (string, error) {
+	dir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "downloads.json"), nil
+}
+
+func (f *FileStorage) Path() string {
+	return f.path
+}
+
+// Load reads the saved items, a missing state file is not an error
+func (f *FileStorage) Load() ([]url.ItemState, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", f.path, err)
+	}
+	if state.Version != stateVersion {
+		return nil, fmt.Errorf("unsupported state version %d in %s", state.Version, f.path)
+	}
+
+	return state.Items, nil
+}
+
+// Save atomically replaces the state file with the given items
+func (f *FileStorage) Save(items []url.ItemState) error {
+	data, err := json.MarshalIndent(stateFile{Version: stateVersion, Items: items}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// Lock takes an exclusive lock on a file next to the state file, which is
+// released when unlocking or when the process exits
+func (f *FileStorage) Lock() (func() error, error) {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(f.path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	// closing the file releases the lock
+	return file.Close, nil
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+)
+
+func TestFileStorage_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "downloads.json")
+	store := NewFileStorage(path)
+
+	items, err := store.Load()
+	if err != nil {
+		t.Fatalf("Expected no error for missing file, got %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("Expected no items, got %d", len(items))
+	}
+
+	startedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	saved := []url.ItemState{
+		{
+			ID:         "0123456789ab",
+			Url:        "https://example.com/video",
+			Stage:      url.StageDownloading,
+			StartedAt:  startedAt,
+			Options:    []string{"-x"},
+			OutputPath: "video.mp4.part",
+		},
+		{
+			Url:     "https://example.com/broken",
+			Stage:   url.StageError,
+			Failure: &url.Failure{Kind: url.FailureExit, ExitCode: 1},
+		},
+	}
+
+	if err := store.Save(saved); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded) != len(saved) {
+		t.Fatalf("Expected %d items, got %d", len(saved), len(loaded))
+	}
+
+	if loaded[0].ID != saved[0].ID || loaded[0].Url != saved[0].Url || loaded[0].Stage != url.StageDownloading {
+		t.Errorf("Unexpected first item %+v", loaded[0])
+	}
+	if !loaded[0].StartedAt.Equal(startedAt) {
+		t.Errorf("Expected StartedAt %v, got %v", startedAt, loaded[0].StartedAt)
+	}
+	if len(loaded[0].Options) != 1 || loaded[0].Options[0] != "-x" {
+		t.Errorf("Unexpected options %v", loaded[0].Options)
+	}
+	if loaded[1].Stage != url.StageError || loaded[1].Failure == nil || loaded[1].Failure.ExitCode != 1 {
+		t.Errorf("Unexpected second item %+v", loaded[1])
+	}
+}
+
+func TestFileStorage_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "downloads.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileStorage(path).Load(); err == nil {
+		t.Error("Expected error for corrupt state file")
+	}
+}
+
+func TestFileStorage_Lock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "downloads.json")
+
+	unlock, err := NewFileStorage(path).Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStorage(path).Lock(); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected the list to be locked, got %v", err)
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = NewFileStorage(path).Lock()
+	if err != nil {
+		t.Fatalf("Expected the lock to be released, got %v", err)
+	}
+	unlock()
+}
+
+func TestDefaultStatePath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/tmp/state")
+
+	path, err := DefaultStatePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/tmp/state/go-ytdlp-mngr/downloads.json" {
+		t.Errorf("Unexpected path %s", path)
+	}
+}
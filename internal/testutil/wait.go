@@ -0,0 +1,22 @@
+// Package testutil holds the helpers shared by the tests of the other
+// packages
+package testutil
+
+import (
+	"testing"
+	"time"
+)
+
+// WaitFor polls condition until it holds, failing the test with what when
+// it does not within two seconds
+func WaitFor(t testing.TB, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
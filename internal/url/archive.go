@@ -0,0 +1,97 @@
+package url
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archivedLine is printed by yt-dlp when it skips a video found in its
+// --download-archive file
+const archivedLine = "has already been recorded in the archive"
+
+// Archive reads the --download-archive file maintained by yt-dlp, which lists
+// one "<extractor> <video id>" per downloaded video. The file is read again
+// whenever it changes. It is safe for concurrent use.
+type Archive struct {
+	path string
+
+	mutex   sync.Mutex
+	ids     map[string]struct{}
+	modTime time.Time
+	size    int64
+}
+
+func NewArchive(path string) *Archive {
+	return &Archive{path: path, ids: make(map[string]struct{})}
+}
+
+func (a *Archive) Path() string {
+	return a.path
+}
+
+// ArchiveID returns the archive entry of a video, or "" if its extractor or
+// id is unknown
+func ArchiveID(metadata *Metadata) string {
+	if metadata == nil || metadata.Extractor == "" || metadata.ID == "" {
+		return ""
+	}
+	return strings.ToLower(metadata.Extractor) + " " + metadata.ID
+}
+
+// Contains returns true if the video described by metadata was downloaded
+func (a *Archive) Contains(metadata *Metadata) (bool, error) {
+	id := ArchiveID(metadata)
+	if id == "" {
+		return false, nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.reloadLocked(); err != nil {
+		return false, err
+	}
+	_, ok := a.ids[id]
+	return ok, nil
+}
+
+// reloadLocked reads the file again if it changed, a.mutex must be held
+func (a *Archive) reloadLocked() error {
+	info, err := os.Stat(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		a.ids = make(map[string]struct{})
+		a.modTime, a.size = time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(a.modTime) && info.Size() == a.size {
+		return nil
+	}
+
+	file, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ids := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			ids[line] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	a.ids = ids
+	a.modTime, a.size = info.ModTime(), info.Size()
+	return nil
+}
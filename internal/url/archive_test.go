@@ -0,0 +1,78 @@
+package url
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.txt")
+	archive := NewArchive(path)
+	video := &Metadata{ID: "dQw4w9WgXcQ", Extractor: "Youtube"}
+
+	if archived, err := archive.Contains(video); err != nil || archived {
+		t.Fatalf("Expected missing archive to contain nothing, got %v %v", archived, err)
+	}
+
+	if err := os.WriteFile(path, []byte("youtube dQw4w9WgXcQ\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if archived, err := archive.Contains(video); err != nil || !archived {
+		t.Errorf("Expected video to be archived once the file is written, got %v %v", archived, err)
+	}
+
+	if archived, _ := archive.Contains(&Metadata{ID: "dQw4w9WgXcQ"}); archived {
+		t.Error("Expected video without extractor not to be checked")
+	}
+}
+
+func TestQueue_Archive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.txt")
+	if err := os.WriteFile(path, []byte("youtube a1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("pre_check", func(t *testing.T) {
+		mockExecutor := NewMockCommandExecutor()
+		started := false
+		mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+			started = true
+			return &MockCommand{Name: name, Args: args, Process: &os.Process{}}
+		}
+
+		queue := NewQueue(1)
+		queue.SetArchive(NewArchive(path))
+
+		urlItem := NewUrlItemEx("https://www.youtube.com/watch?v=a1", mockExecutor)
+		urlItem.metadata = &Metadata{ID: "a1", Extractor: "Youtube"}
+		queue.Add(urlItem)
+		defer queue.StopAll()
+
+		if urlItem.Stage() != StageArchived {
+			t.Errorf("Expected stage StageArchived, got %v", urlItem.Stage())
+		}
+		time.Sleep(20 * time.Millisecond)
+		if started || queue.Running() != 0 {
+			t.Error("Expected yt-dlp not to be started for an archived item")
+		}
+	})
+
+	t.Run("reported_by_ytdlp", func(t *testing.T) {
+		mockExecutor := NewMockCommandExecutor()
+		mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+			return (&MockCommand{Name: name, Args: args, Process: &os.Process{}}).
+				SetStdoutData("[download] Never Gonna Give You Up has already been recorded in the archive\n").
+				SetWaitDuration(time.Millisecond)
+		}
+
+		urlItem := NewUrlItemEx("https://www.youtube.com/watch?v=b2", mockExecutor)
+		urlItem.Start()
+		<-urlItem.Done()
+
+		if urlItem.Stage() != StageArchived {
+			t.Errorf("Expected stage StageArchived, got %v", urlItem.Stage())
+		}
+	})
+}
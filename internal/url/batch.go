@@ -0,0 +1,120 @@
+package url
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+)
+
+// ErrDuplicate is reported for batch entries whose url is already listed
+var ErrDuplicate = errors.New("already in the list")
+
+// BatchError reports a batch entry which was not queued
+type BatchError struct {
+	Entry BatchEntry
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Entry.Line, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// BatchEntry is a url read from a batch file along with its line number
+type BatchEntry struct {
+	Line int
+	Url  string
+}
+
+// ParseBatch reads one url per line in the format of yt-dlp --batch-file.
+// Blank lines and lines starting with '#', ';' or ']' are skipped, and so is
+// anything after a '#' preceded by a space, so urls may be annotated.
+func ParseBatch(r io.Reader) ([]BatchEntry, error) {
+	var entries []BatchEntry
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if text == "" || strings.ContainsAny(text[:1], "#;]") {
+			continue
+		}
+		if idx := strings.Index(text, " #"); idx >= 0 {
+			text = strings.TrimSpace(text[:idx])
+		}
+		entries = append(entries, BatchEntry{Line: line, Url: text})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ReadBatchFile parses the batch file at path, "-" reads from stdin like
+// yt-dlp does
+func ReadBatchFile(path string) ([]BatchEntry, error) {
+	if path == "-" {
+		return ParseBatch(os.Stdin)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseBatch(file)
+}
+
+// BatchItems creates an item downloading with cfg and profile for every entry
+// whose url is valid and neither in the queue nor earlier in the batch. The
+// skipped entries are reported as *BatchError.
+func (q *Queue) BatchItems(entries []BatchEntry, cfg config.Config, profile config.Profile, executor CommandExecutor) ([]*UrlItem, []error) {
+	return NewBatchItems(entries, q.Find, cfg, profile, executor)
+}
+
+// NewBatchItems works like Queue.BatchItems for the items returned by find
+func NewBatchItems(entries []BatchEntry, find func(rawUrl string) *UrlItem, cfg config.Config, profile config.Profile, executor CommandExecutor) ([]*UrlItem, []error) {
+	var items []*UrlItem
+	var errs []error
+	seen := make(map[string]bool)
+
+	for _, entry := range entries {
+		cleaned, err := Clean(entry.Url)
+		if err != nil {
+			errs = append(errs, &BatchError{Entry: entry, Err: err})
+			continue
+		}
+		// duplicates are found by the normalized url, the one given is downloaded
+		normalized, err := Normalize(cleaned)
+		if err != nil {
+			errs = append(errs, &BatchError{Entry: entry, Err: err})
+			continue
+		}
+		if seen[normalized] || find(normalized) != nil {
+			errs = append(errs, &BatchError{Entry: entry, Err: fmt.Errorf("%s: %w", cleaned, ErrDuplicate)})
+			continue
+		}
+		seen[normalized] = true
+
+		item := NewUrlItemEx(cleaned, executor)
+		if err := item.ApplyConfig(cfg, profile); err != nil {
+			errs = append(errs, &BatchError{Entry: entry, Err: err})
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, errs
+}
@@ -0,0 +1,100 @@
+package url
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+)
+
+const batchFile = "\ufeff# videos to watch\n" +
+	"https://youtu.be/dQw4w9WgXcQ\n" +
+	"\n" +
+	"  ; an old comment style\n" +
+	"] another one\n" +
+	"https://example.com/clip #the one with the cat\n" +
+	"https://example.com/page#section\n" +
+	"not a url\n"
+
+func TestParseBatch(t *testing.T) {
+	entries, err := ParseBatch(strings.NewReader(batchFile))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []BatchEntry{
+		{Line: 2, Url: "https://youtu.be/dQw4w9WgXcQ"},
+		{Line: 6, Url: "https://example.com/clip"},
+		{Line: 7, Url: "https://example.com/page#section"},
+		{Line: 8, Url: "not a url"},
+	}
+	if !slices.Equal(entries, expected) {
+		t.Errorf("Expected %v, got %v", expected, entries)
+	}
+}
+
+func TestReadBatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.txt")
+	if err := os.WriteFile(path, []byte(batchFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadBatchFile(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("Expected 4 entries, got %d", len(entries))
+	}
+
+	if _, err := ReadBatchFile(filepath.Join(t.TempDir(), "missing.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist, got %v", err)
+	}
+}
+
+func TestQueue_BatchItems(t *testing.T) {
+	queue := NewQueue(1)
+	queue.Restore(NewUrlItemEx("https://example.com/listed", NewMockCommandExecutor()))
+
+	entries := []BatchEntry{
+		{Line: 1, Url: "https://youtu.be/dQw4w9WgXcQ"},
+		{Line: 2, Url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=30"},
+		{Line: 3, Url: "https://example.com/listed/"},
+		{Line: 4, Url: "not a url"},
+		{Line: 5, Url: "https://example.com/new"},
+	}
+	cfg := config.Default()
+	profile := config.Profile{Name: "audio", Args: []string{"-x"}}
+
+	items, errs := queue.BatchItems(entries, cfg, profile, NewMockCommandExecutor())
+
+	urls := make([]string, 0, len(items))
+	for _, item := range items {
+		urls = append(urls, item.Url)
+		if item.Profile.Name != "audio" {
+			t.Errorf("%s: expected the audio profile, got %q", item.Url, item.Profile.Name)
+		}
+	}
+	// the urls are downloaded as given, duplicates are found once normalized
+	expected := []string{"https://youtu.be/dQw4w9WgXcQ", "https://example.com/new"}
+	if !slices.Equal(urls, expected) {
+		t.Errorf("Expected %v, got %v", expected, urls)
+	}
+
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 skipped entries, got %v", errs)
+	}
+	if !errors.Is(errs[0], ErrDuplicate) || !strings.HasPrefix(errs[0].Error(), "line 2:") {
+		t.Errorf("Expected line 2 to be a duplicate, got %v", errs[0])
+	}
+	if !errors.Is(errs[1], ErrDuplicate) {
+		t.Errorf("Expected line 3 to be a duplicate, got %v", errs[1])
+	}
+	if !strings.HasPrefix(errs[2].Error(), "line 4:") {
+		t.Errorf("Expected line 4 to be invalid, got %v", errs[2])
+	}
+}
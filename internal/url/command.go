@@ -1,9 +1,12 @@
 package url
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"syscall"
 )
 
 // CommandExecutor defines the interface for executing external commands
@@ -14,6 +17,11 @@ type CommandExecutor interface {
 // ProcessState defines the interface for process state information
 type ProcessState interface {
 	Exited() bool
+	// ExitCode returns the exit code of an exited process, or -1 if it was
+	// terminated by a signal
+	ExitCode() int
+	// Signal returns the signal that terminated the process, or nil
+	Signal() os.Signal
 }
 
 // Command defines the interface for a command that can be executed
@@ -73,3 +81,63 @@ type RealProcessState struct {
 func (r *RealProcessState) Exited() bool {
 	return r.state.Exited()
 }
+
+func (r *RealProcessState) ExitCode() int {
+	return r.state.ExitCode()
+}
+
+func (r *RealProcessState) Signal() os.Signal {
+	if status, ok := r.state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal()
+	}
+	return nil
+}
+
+// commandOutput runs a short lived command to completion and returns its
+// stdout. A failed command returns an error carrying its last stderr line.
+func commandOutput(executor CommandExecutor, name string, args ...string) ([]byte, error) {
+	cmd := executor.CreateCommand(name, args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var errOutput []byte
+	errDone := make(chan struct{})
+	go func() {
+		defer close(errDone)
+		errOutput, _ = io.ReadAll(stderr)
+	}()
+
+	output, readErr := io.ReadAll(stdout)
+	<-errDone
+
+	// all reads from the pipes must complete before calling Wait
+	err = cmd.Wait()
+	if state := cmd.GetProcessState(); err == nil && state != nil && state.ExitCode() != 0 {
+		err = fmt.Errorf("exit status %d", state.ExitCode())
+	}
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		if line := lastLine(errOutput); line != "" {
+			return output, fmt.Errorf("%s: %w: %s", name, err, line)
+		}
+		return output, fmt.Errorf("%s: %w", name, err)
+	}
+	return output, nil
+}
+
+func lastLine(data []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
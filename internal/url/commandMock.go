@@ -23,6 +23,21 @@ func NewMockCommandExecutor() *MockCommandExecutor {
 	return executor
 }
 
+// NewMockDownloadExecutor returns an executor whose commands run for wait
+// and print stdout, the commands of the urls containing "fail" print an
+// unsupported url error and exit with 1 instead
+func NewMockDownloadExecutor(wait time.Duration, stdout string) *MockCommandExecutor {
+	executor := NewMockCommandExecutor()
+	executor.CreateCommandFunc = func(name string, args ...string) Command {
+		cmd := (&MockCommand{Name: name, Args: args, Process: &os.Process{}}).SetWaitDuration(wait)
+		if len(args) > 0 && strings.Contains(args[len(args)-1], "fail") {
+			return cmd.SetStderrData("ERROR: Unsupported URL\n").SetExitCode(1)
+		}
+		return cmd.SetStdoutData(stdout)
+	}
+	return executor
+}
+
 func (m *MockCommandExecutor) defaultCreateCommand(name string, args ...string) Command {
 	cmd := &MockCommand{
 		Name:         name,
@@ -52,6 +67,7 @@ type MockCommand struct {
 	StartErr     error
 	WaitErr      error
 	ExitCode     int
+	Signal       os.Signal
 	StdoutData   string
 	StderrData   string
 	ProcessState *os.ProcessState
@@ -144,18 +160,31 @@ func (m *MockCommand) GetProcessState() ProcessState {
 		return nil
 	}
 
-	return &MockProcessState{exited: true}
+	return &MockProcessState{exited: m.Signal == nil, exitCode: m.ExitCode, signal: m.Signal}
 }
 
 // MockProcessState implements ProcessState interface for testing
 type MockProcessState struct {
-	exited bool
+	exited   bool
+	exitCode int
+	signal   os.Signal
 }
 
 func (m *MockProcessState) Exited() bool {
 	return m.exited
 }
 
+func (m *MockProcessState) ExitCode() int {
+	if m.signal != nil {
+		return -1
+	}
+	return m.exitCode
+}
+
+func (m *MockProcessState) Signal() os.Signal {
+	return m.signal
+}
+
 // Helper methods for test setup
 func (m *MockCommand) SetStartError(err error) *MockCommand {
 	m.StartErr = err
@@ -172,6 +201,11 @@ func (m *MockCommand) SetExitCode(code int) *MockCommand {
 	return m
 }
 
+func (m *MockCommand) SetSignal(sig os.Signal) *MockCommand {
+	m.Signal = sig
+	return m
+}
+
 func (m *MockCommand) SetStdoutData(data string) *MockCommand {
 	m.StdoutData = data
 	return m
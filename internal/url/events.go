@@ -0,0 +1,217 @@
+package url
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+type EventType int
+
+const (
+	EventAdded EventType = iota
+	EventStarted
+	EventProgress
+	EventStageChanged
+	EventLogLine
+	EventFinished
+	EventFailed
+	EventRemoved
+	EventMetadata
+)
+
+var eventTypeNames = [...]string{
+	"added",
+	"started",
+	"progress",
+	"stage",
+	"log",
+	"finished",
+	"failed",
+	"removed",
+	"metadata",
+}
+
+func (t EventType) String() string {
+	if t < EventAdded || t > EventMetadata {
+		return "unknown"
+	}
+	return eventTypeNames[t]
+}
+
+func (t EventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *EventType) UnmarshalText(text []byte) error {
+	idx := slices.Index(eventTypeNames[:], string(text))
+	if idx < 0 {
+		return fmt.Errorf("unknown event type %q", text)
+	}
+	*t = EventType(idx)
+	return nil
+}
+
+// Stream identifies the output a log line was read from
+type Stream string
+
+const (
+	StreamStdout Stream = "stdout"
+	StreamStderr Stream = "stderr"
+)
+
+// Event is a download lifecycle notification published on a Bus. Only the
+// fields relevant to its Type are set.
+type Event struct {
+	Type     EventType
+	Item     *UrlItem
+	At       time.Time
+	From     DownloadStage
+	To       DownloadStage
+	Progress Progress
+	Log      LogLine
+	Failure  *Failure
+}
+
+// eventBuffer is the default number of pending events kept per subscriber
+const eventBuffer = 256
+
+// Bus fans out events to every subscriber. Publishing never blocks, a
+// subscriber that falls behind misses the events that do not fit its buffer
+// unless it subscribed with SubscribeLossless.
+type Bus struct {
+	mutex       sync.RWMutex
+	subscribers map[chan Event]subscription
+}
+
+type subscription struct {
+	types []EventType
+	// queue holds the events of a lossless subscription, nil otherwise
+	queue *eventQueue
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan Event]subscription)}
+}
+
+// Subscribe returns a channel receiving the events of the given types, or
+// every event when no type is given, and a function to unsubscribe which
+// closes the channel
+func (b *Bus) Subscribe(types ...EventType) (<-chan Event, func()) {
+	return b.SubscribeBuffered(eventBuffer, types...)
+}
+
+// SubscribeBuffered works like Subscribe with a custom buffer size
+func (b *Bus) SubscribeBuffered(buffer int, types ...EventType) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	b.mutex.Lock()
+	b.subscribers[ch] = subscription{types: slices.Clone(types)}
+	b.mutex.Unlock()
+
+	unsubscribe := func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// SubscribeLossless works like Subscribe but never drops an event, the ones
+// the subscriber did not receive yet are queued without bound. It suits
+// subscribers which keep up on average but must see every event.
+func (b *Bus) SubscribeLossless(types ...EventType) (<-chan Event, func()) {
+	ch := make(chan Event)
+	queue := &eventQueue{signal: make(chan struct{}, 1), done: make(chan struct{})}
+	go queue.forward(ch)
+
+	b.mutex.Lock()
+	b.subscribers[ch] = subscription{types: slices.Clone(types), queue: queue}
+	b.mutex.Unlock()
+
+	unsubscribe := func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			// forward closes the channel once it stops
+			close(queue.done)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// Publish sends the event to the interested subscribers
+func (b *Bus) Publish(event Event) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for ch, sub := range b.subscribers {
+		if len(sub.types) > 0 && !slices.Contains(sub.types, event.Type) {
+			continue
+		}
+		if sub.queue != nil {
+			sub.queue.push(event)
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// eventQueue buffers the events of a lossless subscription
+type eventQueue struct {
+	mutex   sync.Mutex
+	pending []Event
+	// signal wakes forward up when events are pushed
+	signal chan struct{}
+	done   chan struct{}
+}
+
+func (q *eventQueue) push(event Event) {
+	q.mutex.Lock()
+	q.pending = append(q.pending, event)
+	q.mutex.Unlock()
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// forward sends the pushed events to ch in order until done is closed, then
+// closes ch
+func (q *eventQueue) forward(ch chan<- Event) {
+	defer close(ch)
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-q.signal:
+		}
+
+		q.mutex.Lock()
+		events := q.pending
+		q.pending = nil
+		q.mutex.Unlock()
+
+		for _, event := range events {
+			select {
+			case <-q.done:
+				return
+			case ch <- event:
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package url
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBus(t *testing.T) {
+	t.Run("fan_out_and_filter", func(t *testing.T) {
+		bus := NewBus()
+		all, unsubscribeAll := bus.Subscribe()
+		defer unsubscribeAll()
+		failures, unsubscribeFailures := bus.Subscribe(EventFailed)
+		defer unsubscribeFailures()
+
+		bus.Publish(Event{Type: EventAdded})
+		bus.Publish(Event{Type: EventFailed})
+
+		if len(all) != 2 {
+			t.Errorf("Expected 2 events for unfiltered subscriber, got %d", len(all))
+		}
+		if len(failures) != 1 {
+			t.Errorf("Expected 1 event for filtered subscriber, got %d", len(failures))
+		}
+
+		event := <-all
+		if event.At.IsZero() {
+			t.Error("Expected event time to be set")
+		}
+	})
+
+	t.Run("slow_subscriber", func(t *testing.T) {
+		bus := NewBus()
+		events, unsubscribe := bus.SubscribeBuffered(1)
+
+		bus.Publish(Event{Type: EventAdded})
+		bus.Publish(Event{Type: EventRemoved})
+
+		if event := <-events; event.Type != EventAdded {
+			t.Errorf("Expected first event to be kept, got %s", event.Type)
+		}
+
+		unsubscribe()
+		if _, ok := <-events; ok {
+			t.Error("Expected channel to be closed after unsubscribing")
+		}
+	})
+
+	t.Run("lossless", func(t *testing.T) {
+		bus := NewBus()
+		events, unsubscribe := bus.SubscribeLossless(EventProgress)
+
+		for range 1000 {
+			bus.Publish(Event{Type: EventProgress})
+		}
+		bus.Publish(Event{Type: EventAdded})
+
+		for idx := range 1000 {
+			select {
+			case event := <-events:
+				if event.Type != EventProgress {
+					t.Fatalf("Expected only progress events, got %s", event.Type)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Expected every event to be kept, got %d", idx)
+			}
+		}
+
+		unsubscribe()
+		select {
+		case _, ok := <-events:
+			if ok {
+				t.Error("Expected no event left")
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected channel to be closed after unsubscribing")
+		}
+	})
+}
+
+func TestQueue_Events(t *testing.T) {
+	mockExecutor := NewMockCommandExecutor()
+	mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+		return &MockCommand{
+			Name:         name,
+			Args:         args,
+			StdoutData:   "[youtube] abc: Downloading webpage\nytdlp-progress|downloading|50|100|NA|1|1|NA|NA|video.mp4\n",
+			waitDuration: 10 * time.Millisecond,
+		}
+	}
+
+	queue := NewQueue(1)
+	events, unsubscribe := queue.Events().Subscribe()
+	defer unsubscribe()
+
+	urlItem := NewUrlItemEx("https://example.com/video", mockExecutor)
+	queue.Add(urlItem)
+	<-time.After(50 * time.Millisecond)
+	queue.Remove(urlItem)
+
+	received := map[EventType]int{}
+	timeout := time.After(time.Second)
+	for received[EventRemoved] == 0 {
+		select {
+		case event := <-events:
+			if event.Item != urlItem {
+				t.Fatalf("Unexpected item in %s event", event.Type)
+			}
+			received[event.Type]++
+			if event.Type == EventProgress && event.Progress.Percent != 50 {
+				t.Errorf("Expected progress event at 50%%, got %v", event.Progress.Percent)
+			}
+		case <-timeout:
+			t.Fatalf("Timed out, received %v", received)
+		}
+	}
+
+	for _, eventType := range []EventType{EventAdded, EventStarted, EventProgress, EventStageChanged, EventLogLine, EventFinished} {
+		if received[eventType] == 0 {
+			t.Errorf("Expected at least one %s event", eventType)
+		}
+	}
+	// the progress line is parsed, not logged
+	if received[EventLogLine] != 1 {
+		t.Errorf("Expected 1 log line event, got %d", received[EventLogLine])
+	}
+}
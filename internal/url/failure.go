@@ -0,0 +1,101 @@
+package url
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// stderrTailSize is the number of stderr lines kept to explain a failure
+const stderrTailSize = 10
+
+type FailureKind int
+
+const (
+	FailureStart FailureKind = iota
+	FailureExit
+	FailureSignal
+	FailureCancelled
+)
+
+var failureKindNames = [...]string{
+	"start",
+	"exit",
+	"signal",
+	"cancelled",
+}
+
+func (k FailureKind) String() string {
+	if k < FailureStart || k > FailureCancelled {
+		return "unknown"
+	}
+	return failureKindNames[k]
+}
+
+func (k FailureKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *FailureKind) UnmarshalText(text []byte) error {
+	idx := slices.Index(failureKindNames[:], string(text))
+	if idx < 0 {
+		return fmt.Errorf("unknown failure kind %q", text)
+	}
+	*k = FailureKind(idx)
+	return nil
+}
+
+// Failure describes why a download ended up in StageError
+type Failure struct {
+	Kind     FailureKind `json:"kind"`
+	ExitCode int         `json:"exit_code,omitempty"`
+	Signal   string      `json:"signal,omitempty"`
+	Err      string      `json:"error,omitempty"`
+	Stderr   []string    `json:"stderr,omitempty"`
+}
+
+func (f *Failure) String() string {
+	switch f.Kind {
+	case FailureStart:
+		return fmt.Sprintf("failed to start: %s", f.Err)
+	case FailureExit:
+		if f.ExitCode != 0 {
+			return fmt.Sprintf("exited with code %d", f.ExitCode)
+		}
+		return fmt.Sprintf("failed: %s", f.Err)
+	case FailureSignal:
+		return fmt.Sprintf("killed by signal %s", f.Signal)
+	case FailureCancelled:
+		return "cancelled by user"
+	}
+	return f.Err
+}
+
+// lineTail keeps the last lines written to it
+type lineTail struct {
+	mutex sync.Mutex
+	lines []string
+	size  int
+}
+
+func (t *lineTail) Add(line string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.size {
+		t.lines = slices.Delete(t.lines, 0, len(t.lines)-t.size)
+	}
+}
+
+func (t *lineTail) Lines() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return slices.Clone(t.lines)
+}
+
+func (t *lineTail) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.lines = nil
+}
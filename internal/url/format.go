@@ -0,0 +1,74 @@
+package url
+
+import (
+	"cmp"
+	"slices"
+)
+
+// FormatChoice is the video and audio format picked for an item, either may
+// be empty to let yt-dlp choose
+type FormatChoice struct {
+	Video string `json:"video,omitempty"`
+	Audio string `json:"audio,omitempty"`
+}
+
+// Selector returns the value of the -f argument for the choice, or "" when
+// nothing was picked
+func (c FormatChoice) Selector() string {
+	switch {
+	case c.Video != "" && c.Audio != "":
+		return c.Video + "+" + c.Audio
+	case c.Video != "":
+		return c.Video
+	case c.Audio != "":
+		// merged with the best video, or the best single file when the
+		// audio cannot be merged
+		return "bv*+" + c.Audio + "/b"
+	default:
+		return ""
+	}
+}
+
+// HasVideo returns true if the format carries a video stream
+func (f Format) HasVideo() bool {
+	return f.VCodec != "" && f.VCodec != "none"
+}
+
+// HasAudio returns true if the format carries an audio stream
+func (f Format) HasAudio() bool {
+	return f.ACodec != "" && f.ACodec != "none"
+}
+
+// VideoFormats returns the formats with a video stream, highest resolution
+// and bitrate first
+func (m *Metadata) VideoFormats() []Format {
+	formats := slices.DeleteFunc(slices.Clone(m.Formats), func(f Format) bool { return !f.HasVideo() })
+	slices.SortStableFunc(formats, func(a, b Format) int {
+		return cmp.Or(cmp.Compare(b.Height, a.Height), cmp.Compare(b.TBR, a.TBR))
+	})
+	return formats
+}
+
+// AudioFormats returns the audio only formats, highest bitrate first
+func (m *Metadata) AudioFormats() []Format {
+	formats := slices.DeleteFunc(slices.Clone(m.Formats), func(f Format) bool { return f.HasVideo() || !f.HasAudio() })
+	slices.SortStableFunc(formats, func(a, b Format) int {
+		return cmp.Or(cmp.Compare(b.ABR, a.ABR), cmp.Compare(b.TBR, a.TBR))
+	})
+	return formats
+}
+
+// Format returns the format picked for the item
+func (u *UrlItem) Format() FormatChoice {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.format
+}
+
+// SetFormat picks the formats downloaded by the next Start, overriding the
+// -f argument of the config and the profile
+func (u *UrlItem) SetFormat(choice FormatChoice) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.format = choice
+}
@@ -0,0 +1,84 @@
+package url
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+)
+
+func TestFormatChoice_Selector(t *testing.T) {
+	tests := []struct {
+		choice   FormatChoice
+		expected string
+	}{
+		{FormatChoice{}, ""},
+		{FormatChoice{Video: "137"}, "137"},
+		{FormatChoice{Audio: "140"}, "bv*+140/b"},
+		{FormatChoice{Video: "137", Audio: "140"}, "137+140"},
+	}
+
+	for _, tt := range tests {
+		if selector := tt.choice.Selector(); selector != tt.expected {
+			t.Errorf("%+v: expected '%s', got '%s'", tt.choice, tt.expected, selector)
+		}
+	}
+}
+
+func TestMetadata_Formats(t *testing.T) {
+	metadata := &Metadata{Formats: []Format{
+		{ID: "sb0", VCodec: "none", ACodec: "none"},
+		{ID: "18", Height: 360, VCodec: "avc1", ACodec: "mp4a"},
+		{ID: "139", ACodec: "mp4a", VCodec: "none", ABR: 48},
+		{ID: "137", Height: 1080, VCodec: "avc1", ACodec: "none"},
+		{ID: "251", ACodec: "opus", VCodec: "none", ABR: 160},
+	}}
+
+	ids := func(formats []Format) []string {
+		var ids []string
+		for _, format := range formats {
+			ids = append(ids, format.ID)
+		}
+		return ids
+	}
+
+	if video := ids(metadata.VideoFormats()); !slices.Equal(video, []string{"137", "18"}) {
+		t.Errorf("Unexpected video formats %v", video)
+	}
+	if audio := ids(metadata.AudioFormats()); !slices.Equal(audio, []string{"251", "139"}) {
+		t.Errorf("Unexpected audio formats %v", audio)
+	}
+}
+
+func TestUrlItem_Start_Format(t *testing.T) {
+	mockExecutor := NewMockCommandExecutor()
+	mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+		cmd := (&MockCommand{Name: name, Args: args, Process: &os.Process{}}).SetWaitDuration(time.Millisecond)
+		mockExecutor.Command = cmd
+		return cmd
+	}
+
+	urlItem := NewUrlItemEx("https://example.com/video", mockExecutor)
+	if err := urlItem.ApplyConfig(config.Default(), config.Profile{Args: []string{"-f", "bestaudio"}}); err != nil {
+		t.Fatal(err)
+	}
+	urlItem.SetFormat(FormatChoice{Video: "137", Audio: "140"})
+	urlItem.Start()
+	<-urlItem.Done()
+
+	args := mockExecutor.Command.Args
+	idx := slices.Index(args, "137+140")
+	if idx < 1 || args[idx-1] != "-f" || idx < slices.Index(args, "bestaudio") {
+		t.Errorf("Expected the picked formats to override the profile, got %v", args)
+	}
+
+	restored, err := NewUrlItemFromState(urlItem.State(), config.Default(), mockExecutor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Format() != urlItem.Format() {
+		t.Errorf("Expected format to be persisted, got %+v", restored.Format())
+	}
+}
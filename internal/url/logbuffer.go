@@ -0,0 +1,129 @@
+package url
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// LogLine is a line of yt-dlp output
+type LogLine struct {
+	Seq    uint64
+	At     time.Time
+	Stream Stream
+	Text   string
+}
+
+// LogBuffer is a bounded ring buffer of the output of an item, optionally
+// mirrored to a writer such as a log file. It is safe for concurrent use.
+type LogBuffer struct {
+	mutex   sync.RWMutex
+	lines   []LogLine
+	start   int
+	nextSeq uint64
+	writer  io.WriteCloser
+}
+
+func NewLogBuffer(capacity int) *LogBuffer {
+	return &LogBuffer{lines: make([]LogLine, 0, max(capacity, 1))}
+}
+
+// Append stores the line, evicting the oldest one when the buffer is full
+func (b *LogBuffer) Append(stream Stream, text string) LogLine {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.nextSeq++
+	line := LogLine{Seq: b.nextSeq, At: time.Now(), Stream: stream, Text: text}
+
+	if len(b.lines) < cap(b.lines) {
+		b.lines = append(b.lines, line)
+	} else {
+		b.lines[b.start] = line
+		b.start = (b.start + 1) % len(b.lines)
+	}
+
+	b.writeLocked(line)
+	return line
+}
+
+// Mirror writes the line to the writer only, for the lines kept out of the
+// buffer such as progress updates
+func (b *LogBuffer) Mirror(stream Stream, text string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.writeLocked(LogLine{At: time.Now(), Stream: stream, Text: text})
+}
+
+// writeLocked mirrors the line to the writer, which is dropped after failing,
+// b.mutex must be held
+func (b *LogBuffer) writeLocked(line LogLine) {
+	if b.writer == nil {
+		return
+	}
+	if _, err := fmt.Fprintf(b.writer, "%s %s %s\n", line.At.Format(time.RFC3339), line.Stream, line.Text); err != nil {
+		b.writer.Close()
+		b.writer = nil
+	}
+}
+
+// Insert stores a line read from the buffer of another process, keeping its
+// Seq. Lines not newer than the last stored one are ignored.
+func (b *LogBuffer) Insert(line LogLine) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if line.Seq <= b.nextSeq {
+		return false
+	}
+	b.nextSeq = line.Seq
+
+	if len(b.lines) < cap(b.lines) {
+		b.lines = append(b.lines, line)
+	} else {
+		b.lines[b.start] = line
+		b.start = (b.start + 1) % len(b.lines)
+	}
+	return true
+}
+
+// Lines returns every retained line, oldest first
+func (b *LogBuffer) Lines() []LogLine {
+	return b.Since(0)
+}
+
+// Since returns the retained lines whose Seq is greater than seq, oldest first
+func (b *LogBuffer) Since(seq uint64) []LogLine {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	lines := make([]LogLine, 0, len(b.lines))
+	for idx := range b.lines {
+		line := b.lines[(b.start+idx)%len(b.lines)]
+		if line.Seq > seq {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Dropped returns the number of lines evicted from the buffer
+func (b *LogBuffer) Dropped() uint64 {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.nextSeq - uint64(len(b.lines))
+}
+
+// SetWriter mirrors the following lines to w, closing the previous writer
+func (b *LogBuffer) SetWriter(w io.WriteCloser) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var err error
+	if b.writer != nil {
+		err = b.writer.Close()
+	}
+	b.writer = w
+	return err
+}
@@ -0,0 +1,120 @@
+package url
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// failingWriteCloser fails every write, like a log file on a full disk
+type failingWriteCloser struct {
+	nopWriteCloser
+}
+
+func (f *failingWriteCloser) Write([]byte) (int, error) {
+	return 0, errors.New("no space left on device")
+}
+
+type nopWriteCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (n *nopWriteCloser) Close() error {
+	n.closed = true
+	return nil
+}
+
+func TestLogBuffer(t *testing.T) {
+	t.Run("ring", func(t *testing.T) {
+		buffer := NewLogBuffer(3)
+		for _, text := range []string{"a", "b", "c", "d", "e"} {
+			buffer.Append(StreamStdout, text)
+		}
+
+		lines := buffer.Lines()
+		if len(lines) != 3 {
+			t.Fatalf("Expected 3 lines, got %d", len(lines))
+		}
+		for idx, expected := range []string{"c", "d", "e"} {
+			if lines[idx].Text != expected {
+				t.Errorf("Line[%d]: expected '%s', got '%s'", idx, expected, lines[idx].Text)
+			}
+		}
+		if buffer.Dropped() != 2 {
+			t.Errorf("Expected 2 dropped lines, got %d", buffer.Dropped())
+		}
+	})
+
+	t.Run("since", func(t *testing.T) {
+		buffer := NewLogBuffer(10)
+		first := buffer.Append(StreamStdout, "first")
+		buffer.Append(StreamStderr, "second")
+
+		lines := buffer.Since(first.Seq)
+		if len(lines) != 1 || lines[0].Text != "second" || lines[0].Stream != StreamStderr {
+			t.Errorf("Unexpected lines %+v", lines)
+		}
+	})
+
+	t.Run("insert", func(t *testing.T) {
+		buffer := NewLogBuffer(10)
+		if !buffer.Insert(LogLine{Seq: 5, Stream: StreamStdout, Text: "fifth"}) {
+			t.Fatal("Expected the first line to be inserted")
+		}
+		if buffer.Insert(LogLine{Seq: 5, Stream: StreamStdout, Text: "again"}) {
+			t.Error("Expected a line already stored to be ignored")
+		}
+		buffer.Insert(LogLine{Seq: 7, Stream: StreamStderr, Text: "seventh"})
+
+		lines := buffer.Since(5)
+		if len(lines) != 1 || lines[0].Seq != 7 || lines[0].Text != "seventh" {
+			t.Errorf("Unexpected lines %+v", lines)
+		}
+		if buffer.Dropped() != 5 {
+			t.Errorf("Expected the 5 lines missing before the first one to count as dropped, got %d", buffer.Dropped())
+		}
+	})
+
+	t.Run("writer", func(t *testing.T) {
+		buffer := NewLogBuffer(10)
+		writer := &nopWriteCloser{}
+		if err := buffer.SetWriter(writer); err != nil {
+			t.Fatal(err)
+		}
+
+		buffer.Append(StreamStderr, "ERROR: boom")
+
+		if !strings.HasSuffix(writer.String(), " stderr ERROR: boom\n") {
+			t.Errorf("Unexpected log file content '%s'", writer.String())
+		}
+
+		buffer.Mirror(StreamStdout, "[download]  50.0% of 10.00MiB")
+		if !strings.HasSuffix(writer.String(), " stdout [download]  50.0% of 10.00MiB\n") {
+			t.Errorf("Expected the mirrored line in the log file, got '%s'", writer.String())
+		}
+		if len(buffer.Lines()) != 1 {
+			t.Errorf("Expected the mirrored line to be kept out of the buffer, got %+v", buffer.Lines())
+		}
+
+		if err := buffer.SetWriter(nil); err != nil || !writer.closed {
+			t.Error("Expected previous writer to be closed")
+		}
+	})
+	t.Run("writer_error", func(t *testing.T) {
+		buffer := NewLogBuffer(10)
+		writer := &failingWriteCloser{}
+		if err := buffer.SetWriter(writer); err != nil {
+			t.Fatal(err)
+		}
+
+		buffer.Append(StreamStdout, "first")
+		if !writer.closed {
+			t.Error("Expected the failing writer to be closed")
+		}
+		if len(buffer.Lines()) != 1 {
+			t.Error("Expected the line to be kept in the buffer")
+		}
+	})
+}
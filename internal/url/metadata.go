@@ -0,0 +1,134 @@
+package url
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Metadata is the information yt-dlp reports about a video through -J,
+// fields are named after the keys of its info dict. Estimated sizes are
+// floats since yt-dlp computes some of them from the bitrate.
+type Metadata struct {
+	ID             string   `json:"id"`
+	Title          string   `json:"title"`
+	Uploader       string   `json:"uploader,omitempty"`
+	Channel        string   `json:"channel,omitempty"`
+	Duration       float64  `json:"duration,omitempty"`
+	Thumbnail      string   `json:"thumbnail,omitempty"`
+	WebpageURL     string   `json:"webpage_url,omitempty"`
+	Extractor      string   `json:"extractor_key,omitempty"`
+	Filesize       int64    `json:"filesize,omitempty"`
+	FilesizeApprox float64  `json:"filesize_approx,omitempty"`
+	Formats        []Format `json:"formats,omitempty"`
+}
+
+// Summary returns a copy of the metadata without the formats, which run to
+// hundreds of entries and are only needed to pick one
+func (m *Metadata) Summary() *Metadata {
+	if m == nil {
+		return nil
+	}
+	summary := *m
+	summary.Formats = nil
+	return &summary
+}
+
+// Format is one of the formats yt-dlp can download a video in
+type Format struct {
+	ID             string  `json:"format_id"`
+	Ext            string  `json:"ext,omitempty"`
+	Note           string  `json:"format_note,omitempty"`
+	Resolution     string  `json:"resolution,omitempty"`
+	Width          int     `json:"width,omitempty"`
+	Height         int     `json:"height,omitempty"`
+	FPS            float64 `json:"fps,omitempty"`
+	VCodec         string  `json:"vcodec,omitempty"`
+	ACodec         string  `json:"acodec,omitempty"`
+	TBR            float64 `json:"tbr,omitempty"`
+	VBR            float64 `json:"vbr,omitempty"`
+	ABR            float64 `json:"abr,omitempty"`
+	Filesize       int64   `json:"filesize,omitempty"`
+	FilesizeApprox float64 `json:"filesize_approx,omitempty"`
+	Protocol       string  `json:"protocol,omitempty"`
+}
+
+// Length returns the duration of the video, or 0 if it is unknown
+func (m *Metadata) Length() time.Duration {
+	return time.Duration(m.Duration * float64(time.Second))
+}
+
+// Size returns the size yt-dlp estimates for the download, or 0 if it is unknown
+func (m *Metadata) Size() int64 {
+	if m.Filesize > 0 {
+		return m.Filesize
+	}
+	return int64(m.FilesizeApprox)
+}
+
+// Size returns the exact or estimated size of the format, or 0 if it is unknown
+func (f Format) Size() int64 {
+	if f.Filesize > 0 {
+		return f.Filesize
+	}
+	return int64(f.FilesizeApprox)
+}
+
+// ParseMetadata decodes the output of yt-dlp -J
+func ParseMetadata(data []byte) (*Metadata, error) {
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("parsing metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// FetchMetadata runs yt-dlp -J for rawUrl without downloading it
+func FetchMetadata(executor CommandExecutor, binary string, rawUrl string) (*Metadata, error) {
+	output, err := commandOutput(executor, binary, "-J", "--no-playlist", "--no-warnings", rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMetadata(output)
+}
+
+// Metadata returns the metadata fetched for the item, or nil
+func (u *UrlItem) Metadata() *Metadata {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.metadata
+}
+
+// SetMetadata sets the metadata known from elsewhere, such as a playlist
+// listing, before the item is added
+func (u *UrlItem) SetMetadata(metadata *Metadata) {
+	u.mutex.Lock()
+	u.metadata = metadata
+	u.mutex.Unlock()
+
+	u.publish(Event{Type: EventMetadata})
+}
+
+// Title returns the title of the video, falling back to its url until the
+// metadata is known
+func (u *UrlItem) Title() string {
+	if metadata := u.Metadata(); metadata != nil && metadata.Title != "" {
+		return metadata.Title
+	}
+	return u.Url
+}
+
+// FetchMetadata runs yt-dlp -J for the item and stores the result
+func (u *UrlItem) FetchMetadata() error {
+	metadata, err := FetchMetadata(u.executor, u.Config.Binary, u.Url)
+	if err != nil {
+		return err
+	}
+
+	u.mutex.Lock()
+	u.metadata = metadata
+	u.mutex.Unlock()
+
+	u.publish(Event{Type: EventMetadata})
+	return nil
+}
@@ -0,0 +1,131 @@
+package url
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const metadataJSON = `{
+	"id": "dQw4w9WgXcQ",
+	"title": "Never Gonna Give You Up",
+	"uploader": "Rick Astley",
+	"duration": 212.0,
+	"thumbnail": "https://i.ytimg.com/vi/dQw4w9WgXcQ/maxresdefault.jpg",
+	"extractor_key": "Youtube",
+	"filesize_approx": 35651584.5,
+	"formats": [
+		{"format_id": "140", "ext": "m4a", "acodec": "mp4a.40.2", "vcodec": "none", "abr": 129.5, "filesize": 3433514},
+		{"format_id": "137", "ext": "mp4", "width": 1920, "height": 1080, "fps": 25, "vcodec": "avc1.640028", "acodec": "none", "filesize": null, "filesize_approx": 80000000}
+	]
+}`
+
+func TestParseMetadata(t *testing.T) {
+	metadata, err := ParseMetadata([]byte(metadataJSON))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if metadata.Title != "Never Gonna Give You Up" || metadata.Uploader != "Rick Astley" {
+		t.Errorf("Unexpected metadata %+v", metadata)
+	}
+	if metadata.Length() != 212*time.Second {
+		t.Errorf("Expected length 3m32s, got %v", metadata.Length())
+	}
+	if metadata.Size() != 35651584 {
+		t.Errorf("Expected estimated size 35651584, got %d", metadata.Size())
+	}
+	if len(metadata.Formats) != 2 {
+		t.Fatalf("Expected 2 formats, got %d", len(metadata.Formats))
+	}
+	if format := metadata.Formats[1]; format.Height != 1080 || format.Size() != 80000000 {
+		t.Errorf("Unexpected format %+v", format)
+	}
+
+	if _, err := ParseMetadata([]byte(`{"title": `)); err == nil {
+		t.Error("Expected parse error")
+	}
+}
+
+func TestUrlItem_FetchMetadata(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		mockExecutor := NewMockCommandExecutor()
+		mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+			cmd := (&MockCommand{Name: name, Args: args, Process: &os.Process{}}).
+				SetStdoutData(metadataJSON).
+				SetWaitDuration(time.Millisecond)
+			mockExecutor.Command = cmd
+			return cmd
+		}
+
+		urlItem := NewUrlItemEx("https://youtu.be/dQw4w9WgXcQ", mockExecutor)
+		if urlItem.Title() != urlItem.Url {
+			t.Errorf("Expected url as title before fetching, got '%s'", urlItem.Title())
+		}
+
+		if err := urlItem.FetchMetadata(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		args := mockExecutor.Command.Args
+		if !slices.Contains(args, "-J") || args[len(args)-1] != urlItem.Url {
+			t.Errorf("Unexpected arguments %v", args)
+		}
+		if urlItem.Title() != "Never Gonna Give You Up" {
+			t.Errorf("Expected title from metadata, got '%s'", urlItem.Title())
+		}
+		if state := urlItem.State(); state.Metadata == nil || state.Metadata.ID != "dQw4w9WgXcQ" {
+			t.Errorf("Expected metadata to be persisted, got %+v", state.Metadata)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		mockExecutor := NewMockCommandExecutor()
+		mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+			return (&MockCommand{Name: name, Args: args, Process: &os.Process{}}).
+				SetStderrData("ERROR: [youtube] abc: Video unavailable\n").
+				SetExitCode(1).
+				SetWaitDuration(time.Millisecond)
+		}
+
+		urlItem := NewUrlItemEx("https://youtu.be/abc", mockExecutor)
+		err := urlItem.FetchMetadata()
+		if err == nil || !strings.Contains(err.Error(), "Video unavailable") {
+			t.Errorf("Expected error with the stderr reason, got %v", err)
+		}
+		if urlItem.Metadata() != nil {
+			t.Error("Expected no metadata")
+		}
+	})
+}
+
+func TestQueue_Prefetch(t *testing.T) {
+	mockExecutor := NewMockCommandExecutor()
+	mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+		cmd := &MockCommand{Name: name, Args: args, Process: &os.Process{}}
+		if slices.Contains(args, "-J") {
+			cmd.SetStdoutData(metadataJSON).SetWaitDuration(time.Millisecond)
+		}
+		return cmd
+	}
+
+	queue := NewQueue(1)
+	queue.SetPrefetch(true)
+	events, unsubscribe := queue.Events().Subscribe(EventMetadata)
+	defer unsubscribe()
+
+	urlItem := NewUrlItemEx("https://youtu.be/dQw4w9WgXcQ", mockExecutor)
+	queue.Add(urlItem)
+	defer queue.StopAll()
+
+	select {
+	case event := <-events:
+		if event.Item != urlItem || urlItem.Title() != "Never Gonna Give You Up" {
+			t.Errorf("Unexpected metadata event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected metadata to be fetched")
+	}
+}
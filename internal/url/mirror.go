@@ -0,0 +1,52 @@
+package url
+
+import (
+	"slices"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+)
+
+// NewMirrorItem creates an item standing for an item owned by another
+// process, such as the daemon, under the id it has there. A mirror is never
+// started, Sync keeps it up to date with the original.
+func NewMirrorItem(id string, state ItemState, progress Progress, cfg config.Config, executor CommandExecutor) (*UrlItem, error) {
+	item := NewUrlItemEx(state.Url, executor)
+	item.id = id
+
+	profile, _ := cfg.Profile(state.Profile)
+	if err := item.ApplyConfig(cfg, profile); err != nil {
+		return nil, err
+	}
+	item.Options = slices.Clone(state.Options)
+	if state.Group != nil {
+		item.Group = *state.Group
+	}
+
+	item.Sync(state, progress)
+	return item, nil
+}
+
+// Sync copies the lifecycle of the original item into a mirror. The formats
+// of the metadata fetched for the mirror are kept when the state does not
+// list them.
+func (u *UrlItem) Sync(state ItemState, progress Progress) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if state.Metadata != nil && len(state.Metadata.Formats) == 0 && u.metadata != nil {
+		metadata := *state.Metadata
+		metadata.Formats = u.metadata.Formats
+		state.Metadata = &metadata
+	}
+
+	u.stage = state.Stage
+	u.startedAt = state.StartedAt
+	u.stoppedAt = state.StoppedAt
+	u.failure = state.Failure
+	u.attempts = state.Attempts
+	u.nextRetryAt = state.NextRetryAt
+	u.logFile = state.LogFile
+	u.metadata = state.Metadata
+	u.format = state.Format
+	u.progress.Set(progress)
+}
@@ -0,0 +1,43 @@
+package url
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+)
+
+func TestMirrorItem(t *testing.T) {
+	startedAt := time.Now().Add(-time.Minute)
+	state := ItemState{
+		Url:       "https://example.com/video",
+		Stage:     StageDownloading,
+		StartedAt: startedAt,
+		Metadata:  &Metadata{Title: "Video"},
+		Format:    FormatChoice{Video: "137"},
+	}
+
+	mirror, err := NewMirrorItem("42", state, Progress{Percent: 10}, config.Default(), NewMockCommandExecutor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mirror.ID() != "42" || mirror.Stage() != StageDownloading || mirror.Title() != "Video" {
+		t.Errorf("Expected the mirror to take the id and state of the original, got %s %s %q", mirror.ID(), mirror.Stage(), mirror.Title())
+	}
+	if !mirror.StartedAt().Equal(startedAt) || mirror.Progress().Percent != 10 {
+		t.Errorf("Expected the times and progress of the original, got %v %v", mirror.StartedAt(), mirror.Progress())
+	}
+
+	// formats fetched for the mirror are kept, the original does not send them
+	mirror.SetMetadata(&Metadata{Title: "Video", Formats: []Format{{ID: "137"}}})
+	state.Stage = StageCompleted
+	state.Metadata = &Metadata{Title: "Renamed"}
+	mirror.Sync(state, Progress{Percent: 100})
+
+	if mirror.Stage() != StageCompleted || mirror.Progress().Percent != 100 {
+		t.Errorf("Expected the mirror to follow the original, got %s %v", mirror.Stage(), mirror.Progress())
+	}
+	if metadata := mirror.Metadata(); metadata.Title != "Renamed" || len(metadata.Formats) != 1 {
+		t.Errorf("Expected the new metadata with the fetched formats, got %+v", metadata)
+	}
+}
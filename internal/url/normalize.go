@@ -0,0 +1,131 @@
+package url
+
+import (
+	neturl "net/url"
+	"regexp"
+	"strings"
+)
+
+// trackingParams are query parameters which do not change the video a url
+// points to, parameters starting with "utm_" are dropped as well
+var trackingParams = map[string]bool{
+	"fbclid":     true,
+	"gclid":      true,
+	"igshid":     true,
+	"mc_cid":     true,
+	"mc_eid":     true,
+	"ref":        true,
+	"ref_src":    true,
+	"si":         true,
+	"feature":    true,
+	"pp":         true,
+	"ab_channel": true,
+}
+
+var youtubeIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// Clean returns the url to download for rawUrl, the url as given without
+// surrounding spaces and with https:// added when it has no scheme. Unlike
+// Normalize it keeps every parameter, such as the list of a watch url.
+func Clean(rawUrl string) (string, error) {
+	if err := Validate(rawUrl); err != nil {
+		return "", err
+	}
+
+	rawUrl = strings.TrimSpace(rawUrl)
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
+	}
+	return rawUrl, nil
+}
+
+// Normalize returns the canonical form of a video url so that variants of
+// the same url compare equal. Known sites are rewritten to a single form,
+// youtu.be/ID and youtube.com/watch?v=ID&t=30 both become
+// https://www.youtube.com/watch?v=ID, other urls lose their tracking
+// parameters, fragment and trailing slash.
+func Normalize(rawUrl string) (string, error) {
+	rawUrl, err := Clean(rawUrl)
+	if err != nil {
+		return "", err
+	}
+
+	parsed, err := neturl.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+	// the mobile and www variants of the known sites serve the same videos
+	host := strings.ToLower(parsed.Host)
+	host = strings.TrimPrefix(host, "www.")
+	host = strings.TrimPrefix(host, "m.")
+
+	if normalized, ok := normalizeYoutube(host, parsed); ok {
+		return normalized, nil
+	}
+	if normalized, ok := normalizeVimeo(host, parsed); ok {
+		return normalized, nil
+	}
+
+	query := parsed.Query()
+	for key := range query {
+		if trackingParams[key] || strings.HasPrefix(key, "utm_") {
+			query.Del(key)
+		}
+	}
+
+	normalized := neturl.URL{
+		Scheme:   parsed.Scheme,
+		Host:     strings.ToLower(parsed.Host),
+		Path:     strings.TrimSuffix(parsed.Path, "/"),
+		RawQuery: query.Encode(),
+	}
+	return normalized.String(), nil
+}
+
+func normalizeYoutube(host string, parsed *neturl.URL) (string, bool) {
+	var id string
+	path := strings.TrimSuffix(parsed.Path, "/")
+
+	switch host {
+	case "youtu.be":
+		id = strings.TrimPrefix(path, "/")
+	case "youtube.com", "music.youtube.com", "youtube-nocookie.com":
+		if path == "/watch" {
+			id = parsed.Query().Get("v")
+			break
+		}
+		if path == "/playlist" && parsed.Query().Has("list") {
+			return "https://www.youtube.com/playlist?list=" + neturl.QueryEscape(parsed.Query().Get("list")), true
+		}
+		for _, prefix := range []string{"/shorts/", "/embed/", "/live/", "/v/"} {
+			if rest, ok := strings.CutPrefix(path, prefix); ok {
+				id = rest
+			}
+		}
+		if id == "" && path != "" {
+			// channels and other pages keep their path
+			return "https://www.youtube.com" + path, true
+		}
+	default:
+		return "", false
+	}
+
+	if !youtubeIDRe.MatchString(id) {
+		return "", false
+	}
+	return "https://www.youtube.com/watch?v=" + id, true
+}
+
+var vimeoIDRe = regexp.MustCompile(`^/(?:video/)?(\d+)$`)
+
+func normalizeVimeo(host string, parsed *neturl.URL) (string, bool) {
+	if host != "vimeo.com" && host != "player.vimeo.com" {
+		return "", false
+	}
+
+	m := vimeoIDRe.FindStringSubmatch(strings.TrimSuffix(parsed.Path, "/"))
+	if m == nil {
+		return "", false
+	}
+	return "https://vimeo.com/" + m[1], true
+}
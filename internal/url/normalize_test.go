@@ -0,0 +1,76 @@
+package url
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		rawUrl   string
+		expected string
+	}{
+		{"https://youtu.be/dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"youtu.be/dQw4w9WgXcQ?si=abc", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=30", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://m.youtube.com/watch?feature=share&v=dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://youtube.com/shorts/dQw4w9WgXcQ/", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://www.youtube.com/playlist?list=PL123&si=x", "https://www.youtube.com/playlist?list=PL123"},
+		{"https://www.youtube.com/@channel/videos", "https://www.youtube.com/@channel/videos"},
+		{"https://player.vimeo.com/video/76979871", "https://vimeo.com/76979871"},
+		{"https://Example.com/video/1/?utm_source=x&b=2&a=1#comments", "https://example.com/video/1?a=1&b=2"},
+		{"http://example.com/clip", "http://example.com/clip"},
+		{"  https://example.com/clip  ", "https://example.com/clip"},
+	}
+
+	for _, tt := range tests {
+		normalized, err := Normalize(tt.rawUrl)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.rawUrl, err)
+			continue
+		}
+		if normalized != tt.expected {
+			t.Errorf("%s: expected '%s', got '%s'", tt.rawUrl, tt.expected, normalized)
+		}
+	}
+
+	for _, rawUrl := range []string{"", "ftp://example.com/file", "https://", "http://[::1"} {
+		if _, err := Normalize(rawUrl); err == nil {
+			t.Errorf("%q: expected an error", rawUrl)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		rawUrl   string
+		expected string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PL123#t=30", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PL123#t=30"},
+		{"  youtu.be/dQw4w9WgXcQ?si=abc ", "https://youtu.be/dQw4w9WgXcQ?si=abc"},
+	}
+
+	for _, tt := range tests {
+		cleaned, err := Clean(tt.rawUrl)
+		if err != nil || cleaned != tt.expected {
+			t.Errorf("%s: expected '%s', got '%s' (%v)", tt.rawUrl, tt.expected, cleaned, err)
+		}
+	}
+	if _, err := Clean("not a url"); err == nil {
+		t.Error("Expected an invalid url to be rejected")
+	}
+}
+
+func TestQueue_Find(t *testing.T) {
+	queue := NewQueue(1)
+	queue.Restore(NewUrlItemEx("https://www.youtube.com/watch?v=dQw4w9WgXcQ", NewMockCommandExecutor()))
+	queue.Restore(NewUrlItemEx("https://example.com/video", NewMockCommandExecutor()))
+
+	if item := queue.Find("https://youtu.be/dQw4w9WgXcQ?t=42"); item == nil {
+		t.Error("Expected the short url to match the queued video")
+	}
+	if item := queue.Find("https://example.com/video/?utm_campaign=x"); item == nil || item.Url != "https://example.com/video" {
+		t.Errorf("Expected tracking parameters to be ignored, got %v", item)
+	}
+	if item := queue.Find("https://example.com/other"); item != nil {
+		t.Errorf("Expected no match, got %s", item.Url)
+	}
+}
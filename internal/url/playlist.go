@@ -0,0 +1,140 @@
+package url
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"slices"
+	"strings"
+)
+
+// ErrNotPlaylist is returned by FetchPlaylist for urls of a single video
+var ErrNotPlaylist = errors.New("not a playlist")
+
+// Playlist is a playlist or channel listed by yt-dlp --flat-playlist -J
+type Playlist struct {
+	Type       string          `json:"_type"`
+	ID         string          `json:"id"`
+	Title      string          `json:"title"`
+	Uploader   string          `json:"uploader,omitempty"`
+	WebpageURL string          `json:"webpage_url,omitempty"`
+	Entries    []PlaylistEntry `json:"entries"`
+}
+
+// PlaylistEntry is a video of a playlist, only the fields available without
+// extracting the video are set
+type PlaylistEntry struct {
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	URL        string  `json:"url"`
+	WebpageURL string  `json:"webpage_url,omitempty"`
+	Extractor  string  `json:"ie_key,omitempty"`
+	Uploader   string  `json:"uploader,omitempty"`
+	Duration   float64 `json:"duration,omitempty"`
+}
+
+// Group ties together the items expanded from the same playlist
+type Group struct {
+	Url   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// Link returns the url of the entry's video
+func (e PlaylistEntry) Link() string {
+	if e.URL != "" {
+		return e.URL
+	}
+	return e.WebpageURL
+}
+
+// LooksLikePlaylist returns true for the urls of known sites which point to a
+// playlist or a channel rather than a video
+func LooksLikePlaylist(rawUrl string) bool {
+	parsed, err := neturl.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	path := strings.TrimSuffix(parsed.Path, "/")
+
+	switch host {
+	case "youtube.com", "music.youtube.com":
+		if path == "/playlist" {
+			return parsed.Query().Has("list")
+		}
+		return strings.HasPrefix(path, "/@") ||
+			strings.HasPrefix(path, "/channel/") ||
+			strings.HasPrefix(path, "/c/") ||
+			strings.HasPrefix(path, "/user/")
+	case "vimeo.com":
+		return strings.HasPrefix(path, "/showcase/") || strings.HasPrefix(path, "/channels/")
+	case "soundcloud.com":
+		return strings.Contains(path, "/sets/")
+	}
+	return false
+}
+
+// ParsePlaylist decodes the output of yt-dlp --flat-playlist -J
+func ParsePlaylist(data []byte) (*Playlist, error) {
+	var playlist Playlist
+	if err := json.Unmarshal(data, &playlist); err != nil {
+		return nil, fmt.Errorf("parsing playlist: %w", err)
+	}
+	if playlist.Type != "playlist" {
+		return nil, ErrNotPlaylist
+	}
+
+	// entries without a link, such as unavailable videos, cannot be downloaded
+	playlist.Entries = slices.DeleteFunc(playlist.Entries, func(entry PlaylistEntry) bool {
+		return entry.Link() == ""
+	})
+	return &playlist, nil
+}
+
+// FetchPlaylist lists the entries of a playlist or channel without extracting them
+func FetchPlaylist(executor CommandExecutor, binary string, rawUrl string) (*Playlist, error) {
+	output, err := commandOutput(executor, binary, "--flat-playlist", "-J", "--no-warnings", rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePlaylist(output)
+}
+
+// FetchPlaylist lists the entries of the playlist or channel of the item
+func (u *UrlItem) FetchPlaylist() (*Playlist, error) {
+	return FetchPlaylist(u.executor, u.Config.Binary, u.Url)
+}
+
+// Expand creates an item for each entry of playlist, grouped under the url of
+// u and downloaded with its config, profile, options and format. The title and
+// duration known from the listing are kept as their metadata.
+func (u *UrlItem) Expand(playlist *Playlist, entries []PlaylistEntry) []*UrlItem {
+	group := Group{Url: u.Url, Title: playlist.Title}
+	if group.Title == "" {
+		group.Title = u.Url
+	}
+
+	items := make([]*UrlItem, 0, len(entries))
+	for _, entry := range entries {
+		item := NewUrlItemEx(entry.Link(), u.executor)
+		item.Config = u.Config
+		item.Profile = u.Profile
+		item.Options = slices.Clone(u.Options)
+		item.Retry = u.Retry
+		item.Group = group
+		item.logs = NewLogBuffer(u.Config.LogLines)
+		item.format = u.Format()
+		item.metadata = &Metadata{
+			ID:        entry.ID,
+			Title:     entry.Title,
+			Uploader:  entry.Uploader,
+			Duration:  entry.Duration,
+			Extractor: entry.Extractor,
+		}
+		items = append(items, item)
+	}
+	return items
+}
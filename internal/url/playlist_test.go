@@ -0,0 +1,114 @@
+package url
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+)
+
+const playlistJSON = `{
+	"_type": "playlist",
+	"id": "PL123",
+	"title": "Mixtape",
+	"entries": [
+		{"_type": "url", "id": "a1", "title": "First", "url": "https://www.youtube.com/watch?v=a1", "duration": 60},
+		{"_type": "url", "id": "b2", "title": "[Private video]", "url": null},
+		{"_type": "url", "ie_key": "Youtube", "id": "c3", "title": "Third", "url": "https://www.youtube.com/watch?v=c3"}
+	]
+}`
+
+func TestLooksLikePlaylist(t *testing.T) {
+	tests := map[string]bool{
+		"https://www.youtube.com/playlist?list=PL123":   true,
+		"https://www.youtube.com/@somechannel":          true,
+		"https://www.youtube.com/@somechannel/videos":   true,
+		"https://youtube.com/channel/UC123":             true,
+		"https://m.youtube.com/user/someone":            true,
+		"https://soundcloud.com/artist/sets/album":      true,
+		"https://vimeo.com/showcase/123":                true,
+		"https://www.youtube.com/watch?v=a1&list=PL123": false,
+		"https://youtu.be/a1":                           false,
+		"https://www.youtube.com/playlist":              false,
+		"https://example.com/@user":                     false,
+		"not a url %":                                   false,
+	}
+
+	for rawUrl, expected := range tests {
+		if LooksLikePlaylist(rawUrl) != expected {
+			t.Errorf("%s: expected %v", rawUrl, expected)
+		}
+	}
+}
+
+func TestParsePlaylist(t *testing.T) {
+	playlist, err := ParsePlaylist([]byte(playlistJSON))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if playlist.Title != "Mixtape" || len(playlist.Entries) != 2 {
+		t.Errorf("Expected the entries without url to be dropped, got %+v", playlist)
+	}
+
+	if _, err := ParsePlaylist([]byte(metadataJSON)); !errors.Is(err, ErrNotPlaylist) {
+		t.Errorf("Expected ErrNotPlaylist for a video, got %v", err)
+	}
+}
+
+func TestUrlItem_Expand(t *testing.T) {
+	mockExecutor := NewMockCommandExecutor()
+	mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+		cmd := (&MockCommand{Name: name, Args: args, Process: &os.Process{}}).
+			SetStdoutData(playlistJSON).
+			SetWaitDuration(time.Millisecond)
+		mockExecutor.Command = cmd
+		return cmd
+	}
+
+	cfg := config.Default()
+	profile := cfg.Profiles[1]
+
+	urlItem := NewUrlItemEx("https://www.youtube.com/playlist?list=PL123", mockExecutor)
+	if err := urlItem.ApplyConfig(cfg, profile); err != nil {
+		t.Fatal(err)
+	}
+	urlItem.SetFormat(FormatChoice{Audio: "251"})
+
+	playlist, err := urlItem.FetchPlaylist()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !slices.Contains(mockExecutor.Command.Args, "--flat-playlist") {
+		t.Errorf("Expected a flat listing, got %v", mockExecutor.Command.Args)
+	}
+
+	items := urlItem.Expand(playlist, playlist.Entries[1:])
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(items))
+	}
+
+	item := items[0]
+	if item.Url != "https://www.youtube.com/watch?v=c3" || item.Title() != "Third" {
+		t.Errorf("Unexpected item %s '%s'", item.Url, item.Title())
+	}
+	if ArchiveID(item.Metadata()) != "youtube c3" {
+		t.Errorf("Expected archive id from the listing, got '%s'", ArchiveID(item.Metadata()))
+	}
+	if item.Group != (Group{Url: urlItem.Url, Title: "Mixtape"}) {
+		t.Errorf("Unexpected group %+v", item.Group)
+	}
+	if item.Profile.Name != profile.Name || item.Format() != urlItem.Format() {
+		t.Errorf("Expected profile and format to be inherited, got '%s' %+v", item.Profile.Name, item.Format())
+	}
+
+	restored, err := NewUrlItemFromState(item.State(), cfg, mockExecutor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Group != item.Group {
+		t.Errorf("Expected group to be persisted, got %+v", restored.Group)
+	}
+}
@@ -0,0 +1,239 @@
+package url
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressPrefix marks the lines emitted by yt-dlp through ProgressTemplate
+const progressPrefix = "ytdlp-progress|"
+
+// ProgressTemplate is passed to yt-dlp's --progress-template so every progress
+// update is printed as a single pipe separated line that ParseProgressLine understands
+const ProgressTemplate = "download:" + progressPrefix +
+	"%(progress.status)s|" +
+	"%(progress.downloaded_bytes)s|" +
+	"%(progress.total_bytes)s|" +
+	"%(progress.total_bytes_estimate)s|" +
+	"%(progress.speed)s|" +
+	"%(progress.eta)s|" +
+	"%(progress.fragment_index)s|" +
+	"%(progress.fragment_count)s|" +
+	"%(progress.filename)s"
+
+// Progress is a snapshot of the download progress reported by yt-dlp
+type Progress struct {
+	Status          string
+	Percent         float64
+	DownloadedBytes int64
+	TotalBytes      int64
+	Speed           float64
+	ETA             time.Duration
+	FragmentIndex   int
+	FragmentCount   int
+	Filename        string
+	UpdatedAt       time.Time
+}
+
+// Known returns true once at least one progress update has been parsed
+func (p Progress) Known() bool {
+	return !p.UpdatedAt.IsZero()
+}
+
+var (
+	destinationRe = regexp.MustCompile(`^\[(?:download|ExtractAudio|VideoConvertor)\] Destination: (.+)$`)
+	mergerRe      = regexp.MustCompile(`^\[Merger\] Merging formats into "(.+)"$`)
+	alreadyRe     = regexp.MustCompile(`^\[download\] (.+) has already been downloaded`)
+	// sgrRe matches the color sequences printed with --color always
+	sgrRe         = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	defaultLineRe = regexp.MustCompile(`^\[download\]\s+([\d.]+)% of\s+~?\s*([\d.]+)([KMGT]?i?B)(?:\s+at\s+([\d.]+)([KMGT]?i?B)/s)?(?:\s+ETA\s+([\d:]+))?(?:\s+\(frag (\d+)/(\d+)\))?`)
+)
+
+// isProgressLine tells whether the line only reports the download progress.
+// Such lines are parsed into Progress rather than kept in the logs, where
+// they would quickly evict the rest of the output.
+func isProgressLine(line string) bool {
+	line = strings.TrimSpace(stripSGR(line))
+	return strings.HasPrefix(line, progressPrefix) || defaultLineRe.MatchString(line)
+}
+
+// ParseProgressLine updates p with the information found in a single line of
+// yt-dlp output. It returns false when the line carries no progress information.
+func ParseProgressLine(line string, p *Progress) bool {
+	line = strings.TrimSpace(stripSGR(line))
+
+	if rest, ok := strings.CutPrefix(line, progressPrefix); ok {
+		return parseTemplateLine(rest, p)
+	}
+
+	if m := destinationRe.FindStringSubmatch(line); m != nil {
+		p.Filename = m[1]
+		p.UpdatedAt = time.Now()
+		return true
+	}
+
+	if m := mergerRe.FindStringSubmatch(line); m != nil {
+		p.Filename = m[1]
+		p.Status = "merging"
+		p.UpdatedAt = time.Now()
+		return true
+	}
+
+	if m := alreadyRe.FindStringSubmatch(line); m != nil {
+		p.Filename = m[1]
+		p.Status = "finished"
+		p.Percent = 100
+		p.UpdatedAt = time.Now()
+		return true
+	}
+
+	if m := defaultLineRe.FindStringSubmatch(line); m != nil {
+		p.Status = "downloading"
+		p.Percent, _ = strconv.ParseFloat(m[1], 64)
+		p.TotalBytes = int64(parseSize(m[2], m[3]))
+		p.DownloadedBytes = int64(float64(p.TotalBytes) * p.Percent / 100)
+		if m[4] != "" {
+			p.Speed = parseSize(m[4], m[5])
+		}
+		if m[6] != "" {
+			p.ETA = parseClock(m[6])
+		}
+		if m[7] != "" {
+			p.FragmentIndex, _ = strconv.Atoi(m[7])
+			p.FragmentCount, _ = strconv.Atoi(m[8])
+		}
+		p.UpdatedAt = time.Now()
+		return true
+	}
+
+	return false
+}
+
+// stripSGR removes the colors of a line of yt-dlp output
+func stripSGR(line string) string {
+	if !strings.Contains(line, "\x1b[") {
+		return line
+	}
+	return sgrRe.ReplaceAllString(line, "")
+}
+
+func parseTemplateLine(line string, p *Progress) bool {
+	fields := strings.SplitN(line, "|", 9)
+	if len(fields) != 9 {
+		return false
+	}
+
+	p.Status = fields[0]
+	p.DownloadedBytes = parseInt64(fields[1])
+	p.TotalBytes = parseInt64(fields[2])
+	if p.TotalBytes == 0 {
+		p.TotalBytes = parseInt64(fields[3])
+	}
+	p.Speed = parseFloat(fields[4])
+	p.ETA = time.Duration(parseInt64(fields[5])) * time.Second
+	p.FragmentIndex = int(parseInt64(fields[6]))
+	p.FragmentCount = int(parseInt64(fields[7]))
+	if fields[8] != "NA" && fields[8] != "" {
+		p.Filename = fields[8]
+	}
+
+	switch {
+	case p.Status == "finished":
+		p.Percent = 100
+	case p.TotalBytes > 0:
+		p.Percent = float64(p.DownloadedBytes) * 100 / float64(p.TotalBytes)
+	case p.FragmentCount > 0:
+		p.Percent = float64(p.FragmentIndex) * 100 / float64(p.FragmentCount)
+	}
+
+	p.UpdatedAt = time.Now()
+	return true
+}
+
+// parseInt64 parses yt-dlp numeric fields, which may be floats or "NA"
+func parseInt64(s string) int64 {
+	return int64(parseFloat(s))
+}
+
+func parseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+func parseSize(value string, unit string) float64 {
+	multipliers := map[string]float64{
+		"B":   1,
+		"KiB": 1 << 10,
+		"MiB": 1 << 20,
+		"GiB": 1 << 30,
+		"TiB": 1 << 40,
+		"KB":  1e3,
+		"MB":  1e6,
+		"GB":  1e9,
+		"TB":  1e12,
+	}
+	return parseFloat(value) * multipliers[unit]
+}
+
+// FormatBytes prints a number of bytes with the binary unit yt-dlp uses
+func FormatBytes(b float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for b >= 1024 && i < len(units)-1 {
+		b /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", b, units[i])
+}
+
+// parseClock parses durations in the [[HH:]MM:]SS form used by yt-dlp
+func parseClock(s string) time.Duration {
+	var total time.Duration
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		total = total*60 + time.Duration(n)
+	}
+	return total * time.Second
+}
+
+// progressTracker guards the progress of an item shared between the reader
+// goroutines and the UI
+type progressTracker struct {
+	mutex   sync.RWMutex
+	current Progress
+}
+
+func (t *progressTracker) Parse(line string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return ParseProgressLine(line, &t.current)
+}
+
+func (t *progressTracker) Snapshot() Progress {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.current
+}
+
+func (t *progressTracker) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.current = Progress{}
+}
+
+// Set replaces the progress with one reported elsewhere
+func (t *progressTracker) Set(p Progress) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.current = p
+}
@@ -0,0 +1,167 @@
+package url
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	t.Run("template_line", func(t *testing.T) {
+		var p Progress
+		line := "ytdlp-progress|downloading|5242880|10485760|NA|1048576.5|5|3|10|/tmp/video.mp4.part"
+
+		if !ParseProgressLine(line, &p) {
+			t.Fatal("Expected template line to be parsed")
+		}
+
+		if p.Status != "downloading" {
+			t.Errorf("Expected status 'downloading', got '%s'", p.Status)
+		}
+		if p.DownloadedBytes != 5242880 || p.TotalBytes != 10485760 {
+			t.Errorf("Unexpected bytes %d/%d", p.DownloadedBytes, p.TotalBytes)
+		}
+		if p.Percent != 50 {
+			t.Errorf("Expected 50%%, got %v", p.Percent)
+		}
+		if p.Speed != 1048576.5 {
+			t.Errorf("Expected speed 1048576.5, got %v", p.Speed)
+		}
+		if p.ETA != 5*time.Second {
+			t.Errorf("Expected ETA 5s, got %v", p.ETA)
+		}
+		if p.FragmentIndex != 3 || p.FragmentCount != 10 {
+			t.Errorf("Unexpected fragments %d/%d", p.FragmentIndex, p.FragmentCount)
+		}
+		if p.Filename != "/tmp/video.mp4.part" {
+			t.Errorf("Unexpected filename '%s'", p.Filename)
+		}
+		if !p.Known() {
+			t.Error("Progress should be known after an update")
+		}
+	})
+
+	t.Run("template_line_estimate", func(t *testing.T) {
+		var p Progress
+		line := "ytdlp-progress|downloading|250|NA|1000|NA|NA|NA|NA|NA"
+
+		if !ParseProgressLine(line, &p) {
+			t.Fatal("Expected template line to be parsed")
+		}
+		if p.TotalBytes != 1000 || p.Percent != 25 {
+			t.Errorf("Expected estimate total 1000 at 25%%, got %d at %v", p.TotalBytes, p.Percent)
+		}
+		if p.Filename != "" {
+			t.Errorf("Expected empty filename for NA, got '%s'", p.Filename)
+		}
+	})
+
+	t.Run("default_line", func(t *testing.T) {
+		var p Progress
+		line := "[download]  42.5% of ~  10.00MiB at    2.00MiB/s ETA 01:05 (frag 4/12)"
+
+		if !ParseProgressLine(line, &p) {
+			t.Fatal("Expected default progress line to be parsed")
+		}
+		if p.Percent != 42.5 {
+			t.Errorf("Expected 42.5%%, got %v", p.Percent)
+		}
+		if p.TotalBytes != 10<<20 {
+			t.Errorf("Expected total 10MiB, got %d", p.TotalBytes)
+		}
+		if p.Speed != 2<<20 {
+			t.Errorf("Expected speed 2MiB/s, got %v", p.Speed)
+		}
+		if p.ETA != 65*time.Second {
+			t.Errorf("Expected ETA 65s, got %v", p.ETA)
+		}
+		if p.FragmentIndex != 4 || p.FragmentCount != 12 {
+			t.Errorf("Unexpected fragments %d/%d", p.FragmentIndex, p.FragmentCount)
+		}
+	})
+
+	t.Run("colored_line", func(t *testing.T) {
+		var p Progress
+		line := "[download] \x1b[0;94m 42.5%\x1b[0m of ~  \x1b[0;33m10.00MiB\x1b[0m at \x1b[0;32m   2.00MiB/s\x1b[0m ETA \x1b[0;33m01:05\x1b[0m"
+
+		if !isProgressLine(line) {
+			t.Error("Expected the colored line to be a progress line")
+		}
+		if !ParseProgressLine(line, &p) {
+			t.Fatal("Expected colored progress line to be parsed")
+		}
+		if p.Percent != 42.5 || p.TotalBytes != 10<<20 || p.ETA != 65*time.Second {
+			t.Errorf("Unexpected progress %v%% of %d, ETA %v", p.Percent, p.TotalBytes, p.ETA)
+		}
+	})
+
+	t.Run("destination_lines", func(t *testing.T) {
+		var p Progress
+
+		ParseProgressLine("[download] Destination: My Video [abc].f137.mp4", &p)
+		if p.Filename != "My Video [abc].f137.mp4" {
+			t.Errorf("Unexpected filename '%s'", p.Filename)
+		}
+
+		ParseProgressLine(`[Merger] Merging formats into "My Video [abc].mp4"`, &p)
+		if p.Filename != "My Video [abc].mp4" || p.Status != "merging" {
+			t.Errorf("Unexpected merge state '%s' '%s'", p.Filename, p.Status)
+		}
+	})
+
+	t.Run("unrelated_line", func(t *testing.T) {
+		var p Progress
+		if ParseProgressLine("[youtube] abc: Downloading webpage", &p) {
+			t.Error("Expected unrelated line to be ignored")
+		}
+		if p.Known() {
+			t.Error("Progress should be unknown")
+		}
+	})
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes    float64
+		expected string
+	}{
+		{0, "0.0B"},
+		{1023, "1023.0B"},
+		{1024, "1.0KiB"},
+		{1536, "1.5KiB"},
+		{10 * (1 << 20), "10.0MiB"},
+		{2.5 * (1 << 30), "2.5GiB"},
+		{2048 * (1 << 40), "2048.0TiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.bytes); got != tt.expected {
+			t.Errorf("FormatBytes(%v) = %q, expected %q", tt.bytes, got, tt.expected)
+		}
+	}
+}
+
+func TestUrlItem_Progress(t *testing.T) {
+	mockExecutor := NewMockCommandExecutor()
+	mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+		cmd := &MockCommand{
+			Name:         name,
+			Args:         args,
+			StdoutData:   "[download] Destination: video.mp4\rytdlp-progress|downloading|30|100|NA|10|7|NA|NA|video.mp4\n",
+			waitDuration: 50 * time.Millisecond,
+		}
+		mockExecutor.Command = cmd
+		return cmd
+	}
+
+	urlItem := NewUrlItemEx("https://example.com/video", mockExecutor)
+	urlItem.Start()
+
+	time.Sleep(100 * time.Millisecond)
+
+	p := urlItem.Progress()
+	if p.Percent != 30 {
+		t.Errorf("Expected 30%%, got %v", p.Percent)
+	}
+	if p.Filename != "video.mp4" {
+		t.Errorf("Expected filename 'video.mp4', got '%s'", p.Filename)
+	}
+}
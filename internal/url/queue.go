@@ -0,0 +1,442 @@
+package url
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+)
+
+// Queue owns the list of items and runs at most Concurrency of them at a time,
+// promoting the next queued item whenever a running one finishes
+type Queue struct {
+	mutex       sync.Mutex
+	items       []*UrlItem
+	running     map[*UrlItem]struct{}
+	concurrency int
+	stopped     bool
+	bus         *Bus
+	prefetch    bool
+	fetchSlots  chan struct{}
+	archive     *Archive
+}
+
+// metadataFetches is the number of yt-dlp -J processes run at the same time
+const metadataFetches = 4
+
+func NewQueue(concurrency int) *Queue {
+	return &Queue{
+		items:       []*UrlItem{},
+		running:     make(map[*UrlItem]struct{}),
+		concurrency: max(concurrency, 1),
+		bus:         NewBus(),
+		fetchSlots:  make(chan struct{}, metadataFetches),
+	}
+}
+
+// ApplyConfig sets the metadata prefetch and the archive of the config
+func (q *Queue) ApplyConfig(cfg config.Config) {
+	q.SetPrefetch(cfg.PrefetchMetadata)
+	if cfg.ArchiveFile != "" {
+		// yt-dlp creates the archive but not its directory
+		if err := os.MkdirAll(filepath.Dir(cfg.ArchiveFile), 0o755); err != nil {
+			log.Println(err)
+		}
+		q.SetArchive(NewArchive(cfg.ArchiveFile))
+	}
+}
+
+// SetPrefetch enables fetching the metadata of the items added to the queue
+// that do not have it yet
+func (q *Queue) SetPrefetch(enabled bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.prefetch = enabled
+}
+
+// Events returns the bus on which the lifecycle events of every item in the
+// queue are published
+func (q *Queue) Events() *Bus {
+	return q.bus
+}
+
+// Items returns a copy of the items in queue order
+func (q *Queue) Items() []*UrlItem {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return slices.Clone(q.items)
+}
+
+// Find returns the item of the queue downloading the same url as rawUrl once
+// both are normalized, or nil
+func (q *Queue) Find(rawUrl string) *UrlItem {
+	return FindUrl(q.Items(), rawUrl)
+}
+
+// FindUrl returns the first of items downloading the same url as rawUrl once
+// both are normalized, or nil
+func FindUrl(items []*UrlItem, rawUrl string) *UrlItem {
+	normalized, err := Normalize(rawUrl)
+	if err != nil {
+		return nil
+	}
+
+	for _, item := range items {
+		if other, err := Normalize(item.Url); err == nil && other == normalized {
+			return item
+		}
+	}
+	return nil
+}
+
+// SetFormat picks the formats downloaded by the next start of item
+func (q *Queue) SetFormat(item *UrlItem, choice FormatChoice) {
+	item.SetFormat(choice)
+}
+
+// Logs returns the output of item
+func (q *Queue) Logs(item *UrlItem) *LogBuffer {
+	return item.Logs()
+}
+
+// Get returns the item of the queue with the given id, or nil
+func (q *Queue) Get(id string) *UrlItem {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, item := range q.items {
+		if item.ID() == id {
+			return item
+		}
+	}
+	return nil
+}
+
+// claimID gives item a new id when another item of the queue has it, such
+// as a state file listing an item twice. The caller holds q.mutex.
+func (q *Queue) claimID(item *UrlItem) {
+	for slices.ContainsFunc(q.items, func(other *UrlItem) bool { return other.id == item.id }) {
+		item.id = newItemID()
+	}
+}
+
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.items)
+}
+
+// SetArchive makes the queue skip the items found in archive, marking them
+// StageArchived instead of starting them
+func (q *Queue) SetArchive(archive *Archive) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.archive = archive
+}
+
+// Add appends the items in StageQueued and starts as many as the concurrency allows
+func (q *Queue) Add(items ...*UrlItem) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, item := range items {
+		_ = item.setStage(StageQueued)
+		q.claimID(item)
+		q.attach(item)
+		q.items = append(q.items, item)
+		if !q.checkArchive(item) {
+			q.fetchMetadata(item)
+		}
+	}
+	q.schedule()
+}
+
+// Restore appends previously saved items keeping their stage, queued ones
+// are started as the concurrency allows
+func (q *Queue) Restore(items ...*UrlItem) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, item := range items {
+		q.claimID(item)
+		q.attach(item)
+		q.items = append(q.items, item)
+		q.fetchMetadata(item)
+	}
+	q.schedule()
+}
+
+// Remove drops the item from the queue, stopping it if it is running
+func (q *Queue) Remove(item *UrlItem) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	idx := slices.Index(q.items, item)
+	if idx < 0 {
+		return
+	}
+	q.items = slices.Delete(q.items, idx, idx+1)
+	q.detach(item)
+	go item.Stop()
+}
+
+// RemoveCompleted drops every item in StageCompleted or StageArchived
+func (q *Queue) RemoveCompleted() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.items = slices.DeleteFunc(q.items, func(item *UrlItem) bool {
+		if stage := item.Stage(); stage != StageCompleted && stage != StageArchived {
+			return false
+		}
+		q.detach(item)
+		go item.Stop()
+		return true
+	})
+}
+
+// Pause holds a queued item or stops a downloading one keeping its partial
+// file, freeing its download slot. It returns false if the item was neither.
+func (q *Queue) Pause(item *UrlItem) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if _, ok := q.running[item]; !ok && item.setStageFrom(StageQueued, StagePaused) {
+		return true
+	}
+	if item.Stage() == StageDownloading {
+		go item.Pause()
+		return true
+	}
+	return false
+}
+
+// Resume queues a paused item again, it continues from its partial file once
+// a download slot is free. It returns false if the item was not paused.
+func (q *Queue) Resume(item *UrlItem) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !item.setStageFrom(StagePaused, StageQueued) {
+		return false
+	}
+	q.schedule()
+	return true
+}
+
+// Retry queues a failed item again with a fresh count of attempts. It returns
+// false if the item is not in the queue or did not fail.
+func (q *Queue) Retry(item *UrlItem) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !slices.Contains(q.items, item) || !item.setStageFrom(StageError, StageQueued) {
+		return false
+	}
+	item.resetAttempts()
+	q.schedule()
+	return true
+}
+
+func (q *Queue) Concurrency() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.concurrency
+}
+
+// SetConcurrency changes how many items may run at once. Lowering it lets
+// running downloads finish, it only delays the promotion of queued ones.
+func (q *Queue) SetConcurrency(n int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.concurrency = max(n, 1)
+	q.schedule()
+}
+
+// Running returns the number of items currently holding a download slot
+func (q *Queue) Running() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.running)
+}
+
+// Move shifts a queued item by delta positions among the queued items,
+// changing the order in which they will be started
+func (q *Queue) Move(item *UrlItem, delta int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !q.queued(item) {
+		return
+	}
+
+	idx := slices.Index(q.items, item)
+	for idx >= 0 && delta != 0 {
+		step := 1
+		if delta < 0 {
+			step = -1
+		}
+
+		next := idx + step
+		for next >= 0 && next < len(q.items) && !q.queued(q.items[next]) {
+			next += step
+		}
+		if next < 0 || next >= len(q.items) {
+			return
+		}
+
+		q.items[idx], q.items[next] = q.items[next], q.items[idx]
+		idx = next
+		delta -= step
+	}
+}
+
+func (q *Queue) SortByComplete() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	sort.Stable(ByComplete(q.items))
+}
+
+// StopAll prevents further items from being promoted and stops every item
+func (q *Queue) StopAll() {
+	q.mutex.Lock()
+	q.stopped = true
+	items := slices.Clone(q.items)
+	q.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			item.Stop()
+		}()
+	}
+	wg.Wait()
+}
+
+// schedule starts queued items while there are free slots, q.mutex must be held
+func (q *Queue) schedule() {
+	if q.stopped {
+		return
+	}
+
+	for _, item := range q.items {
+		if len(q.running) >= q.concurrency {
+			return
+		}
+		if !q.queued(item) {
+			continue
+		}
+
+		q.running[item] = struct{}{}
+		go q.run(item)
+	}
+}
+
+// attach makes the item publish its events on the queue bus, q.mutex must be held
+func (q *Queue) attach(item *UrlItem) {
+	item.bus.Store(q.bus)
+	q.bus.Publish(Event{Type: EventAdded, Item: item, To: item.Stage()})
+}
+
+// detach stops publishing the events of a removed item, q.mutex must be held
+func (q *Queue) detach(item *UrlItem) {
+	item.bus.Store(nil)
+	q.bus.Publish(Event{Type: EventRemoved, Item: item})
+}
+
+// fetchMetadata fetches the metadata of the item in the background when
+// prefetching is enabled, q.mutex must be held
+func (q *Queue) fetchMetadata(item *UrlItem) {
+	if !q.prefetch || item.Metadata() != nil {
+		return
+	}
+
+	go func() {
+		q.fetchSlots <- struct{}{}
+		defer func() { <-q.fetchSlots }()
+
+		if err := item.FetchMetadata(); err != nil {
+			log.Println(err)
+			return
+		}
+
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		if _, running := q.running[item]; !running {
+			q.checkArchive(item)
+		}
+	}()
+}
+
+// checkArchive marks a queued item found in the archive as StageArchived,
+// q.mutex must be held
+func (q *Queue) checkArchive(item *UrlItem) bool {
+	if q.archive == nil {
+		return false
+	}
+
+	archived, err := q.archive.Contains(item.Metadata())
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return archived && item.setStageFrom(StageQueued, StageArchived)
+}
+
+// queued returns true if the item waits for a download slot, q.mutex must be held
+func (q *Queue) queued(item *UrlItem) bool {
+	_, running := q.running[item]
+	return !running && item.Stage() == StageQueued
+}
+
+func (q *Queue) run(item *UrlItem) {
+	q.mutex.Lock()
+	archived := q.checkArchive(item)
+	q.mutex.Unlock()
+
+	// the item may have been paused since it was scheduled
+	if !archived && item.start(StageQueued) {
+		if done := item.Done(); done != nil {
+			<-done
+		}
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.running, item)
+	q.scheduleRetry(item)
+	q.schedule()
+}
+
+// scheduleRetry puts a failed item back in StageQueued once the backoff of its
+// retry policy has elapsed, q.mutex must be held
+func (q *Queue) scheduleRetry(item *UrlItem) {
+	if q.stopped || item.Stage() != StageError || !item.Retry.ShouldRetry(item.Failure(), item.Attempts()) {
+		return
+	}
+
+	backoff := item.Retry.Backoff(item.Attempts())
+	at := time.Now().Add(backoff)
+	item.setNextRetryAt(at)
+
+	time.AfterFunc(backoff, func() {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+
+		// a manual retry since then cleared or replaced the scheduled one
+		if q.stopped || !slices.Contains(q.items, item) || !item.NextRetryAt().Equal(at) {
+			return
+		}
+		if item.setStageFrom(StageError, StageQueued) {
+			q.schedule()
+		}
+	})
+}
@@ -0,0 +1,258 @@
+package url
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+)
+
+func countStage(items []*UrlItem, stage DownloadStage) int {
+	count := 0
+	for _, item := range items {
+		if item.Stage() == stage {
+			count++
+		}
+	}
+	return count
+}
+
+func TestQueue_Concurrency(t *testing.T) {
+	mockExecutor := NewMockDownloadExecutor(100*time.Millisecond, "")
+	queue := NewQueue(2)
+
+	items := []*UrlItem{
+		NewUrlItemEx("https://example.com/1", mockExecutor),
+		NewUrlItemEx("https://example.com/2", mockExecutor),
+		NewUrlItemEx("https://example.com/3", mockExecutor),
+	}
+	queue.Add(items...)
+
+	time.Sleep(50 * time.Millisecond)
+
+	if got := countStage(items, StageDownloading); got != 2 {
+		t.Errorf("Expected 2 downloading items, got %d", got)
+	}
+	if items[2].Stage() != StageQueued {
+		t.Errorf("Expected third item to be queued, got %v", items[2].Stage())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if got := countStage(items, StageCompleted); got != 2 {
+		t.Errorf("Expected 2 completed items, got %d", got)
+	}
+	if items[2].Stage() != StageDownloading {
+		t.Errorf("Expected third item to be promoted, got %v", items[2].Stage())
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if got := countStage(items, StageCompleted); got != 3 {
+		t.Errorf("Expected 3 completed items, got %d", got)
+	}
+	if queue.Running() != 0 {
+		t.Errorf("Expected no running items, got %d", queue.Running())
+	}
+}
+
+func TestQueue_SetConcurrency(t *testing.T) {
+	mockExecutor := NewMockDownloadExecutor(100*time.Millisecond, "")
+	queue := NewQueue(1)
+
+	items := []*UrlItem{
+		NewUrlItemEx("https://example.com/1", mockExecutor),
+		NewUrlItemEx("https://example.com/2", mockExecutor),
+		NewUrlItemEx("https://example.com/3", mockExecutor),
+	}
+	queue.Add(items...)
+
+	time.Sleep(20 * time.Millisecond)
+	if got := countStage(items, StageDownloading); got != 1 {
+		t.Errorf("Expected 1 downloading item, got %d", got)
+	}
+
+	queue.SetConcurrency(3)
+	time.Sleep(20 * time.Millisecond)
+	if got := countStage(items, StageDownloading); got != 3 {
+		t.Errorf("Expected 3 downloading items, got %d", got)
+	}
+
+	queue.SetConcurrency(0)
+	if queue.Concurrency() != 1 {
+		t.Errorf("Expected concurrency to be clamped to 1, got %d", queue.Concurrency())
+	}
+}
+
+func TestQueue_Move(t *testing.T) {
+	mockExecutor := NewMockDownloadExecutor(100*time.Millisecond, "")
+	queue := NewQueue(1)
+
+	first := NewUrlItemEx("https://example.com/1", mockExecutor)
+	second := NewUrlItemEx("https://example.com/2", mockExecutor)
+	third := NewUrlItemEx("https://example.com/3", mockExecutor)
+	queue.Add(first, second, third)
+
+	queue.Move(third, -1)
+
+	items := queue.Items()
+	if items[1] != third || items[2] != second {
+		t.Errorf("Expected third item to move before second")
+	}
+
+	// the running item is not queued anymore and must not be swapped
+	queue.Move(third, -1)
+	if queue.Items()[0] != first {
+		t.Errorf("Expected running item to keep its position")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if third.Stage() != StageDownloading || second.Stage() != StageQueued {
+		t.Errorf("Expected reordered item to be promoted first, got %v and %v", third.Stage(), second.Stage())
+	}
+}
+
+func TestQueue_Remove(t *testing.T) {
+	mockExecutor := NewMockDownloadExecutor(50*time.Millisecond, "")
+	queue := NewQueue(1)
+
+	first := NewUrlItemEx("https://example.com/1", mockExecutor)
+	second := NewUrlItemEx("https://example.com/2", mockExecutor)
+	queue.Add(first, second)
+
+	queue.Remove(second)
+	if queue.Len() != 1 {
+		t.Fatalf("Expected 1 item, got %d", queue.Len())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if second.Stage() != StageQueued {
+		t.Errorf("Expected removed item to never start, got %v", second.Stage())
+	}
+
+	queue.RemoveCompleted()
+	if queue.Len() != 0 {
+		t.Errorf("Expected completed item to be removed, got %d items", queue.Len())
+	}
+}
+
+func TestQueue_PauseResume(t *testing.T) {
+	mockExecutor := NewMockDownloadExecutor(100*time.Millisecond, "")
+	queue := NewQueue(1)
+
+	first := NewUrlItemEx("https://example.com/1", mockExecutor)
+	second := NewUrlItemEx("https://example.com/2", mockExecutor)
+	queue.Add(first, second)
+
+	queue.Pause(second)
+	if second.Stage() != StagePaused {
+		t.Fatalf("Expected queued item to be paused, got %v", second.Stage())
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if second.Stage() != StagePaused {
+		t.Errorf("Expected paused item not to be promoted, got %v", second.Stage())
+	}
+
+	queue.Resume(second)
+	time.Sleep(20 * time.Millisecond)
+	if second.Stage() != StageDownloading {
+		t.Errorf("Expected resumed item to start, got %v", second.Stage())
+	}
+}
+
+func TestQueue_Get(t *testing.T) {
+	mockExecutor := NewMockDownloadExecutor(time.Millisecond, "")
+	queue := NewQueue(1)
+
+	first := NewUrlItemEx("https://example.com/1", mockExecutor)
+	second := NewUrlItemEx("https://example.com/2", mockExecutor)
+	queue.Restore(first, second)
+
+	if first.ID() == second.ID() {
+		t.Fatalf("Expected distinct ids, got %s twice", first.ID())
+	}
+	if queue.Get(second.ID()) != second {
+		t.Error("Expected the item with the id of the second one")
+	}
+
+	// a state file listing the same item twice
+	state := first.State()
+	state.Stage = StageCompleted
+	copied, err := NewUrlItemFromState(state, config.Default(), mockExecutor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Restore(copied)
+	if copied.ID() == first.ID() || queue.Get(first.ID()) != first || queue.Get(copied.ID()) != copied {
+		t.Errorf("Expected the copy to get its own id, got %s and %s", first.ID(), copied.ID())
+	}
+
+	queue.Remove(second)
+	if queue.Get(second.ID()) != nil {
+		t.Error("Expected no item once removed")
+	}
+}
+
+func TestQueue_RetryFailed(t *testing.T) {
+	mockExecutor := NewMockCommandExecutor()
+	mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+		return (&MockCommand{Name: name, Args: args, Process: &os.Process{}}).
+			SetWaitDuration(time.Millisecond).
+			SetExitCode(1)
+	}
+	queue := NewQueue(1)
+
+	item := NewUrlItemEx("https://example.com/video", mockExecutor)
+	item.Retry = RetryPolicy{MaxAttempts: 1}
+	queue.Add(item)
+	time.Sleep(50 * time.Millisecond)
+
+	if item.Stage() != StageError || item.Attempts() != 1 {
+		t.Fatalf("Expected the item to fail once, got %v after %d attempts", item.Stage(), item.Attempts())
+	}
+
+	if !queue.Retry(item) {
+		t.Fatal("Expected the failed item to be retried")
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if item.Attempts() != 1 {
+		t.Errorf("Expected the attempts to start over, got %d", item.Attempts())
+	}
+	if queue.Retry(NewUrlItemEx("https://example.com/other", mockExecutor)) {
+		t.Error("Expected an item outside the queue not to be retried")
+	}
+}
+
+func TestQueue_RetryReplacesBackoff(t *testing.T) {
+	mockExecutor := NewMockCommandExecutor()
+	mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+		return (&MockCommand{Name: name, Args: args, Process: &os.Process{}}).
+			SetWaitDuration(time.Millisecond).
+			SetExitCode(1)
+	}
+	queue := NewQueue(1)
+
+	item := NewUrlItemEx("https://example.com/video", mockExecutor)
+	item.Retry = RetryPolicy{MaxAttempts: 2, InitialBackoff: 100 * time.Millisecond, ExitCodes: []int{1}}
+	queue.Add(item)
+	time.Sleep(20 * time.Millisecond)
+
+	if item.Stage() != StageError || item.NextRetryAt().IsZero() {
+		t.Fatalf("Expected a retry to be scheduled, got %v", item.Stage())
+	}
+
+	// retried by hand before the backoff ends, failing again with a longer one
+	item.Retry.InitialBackoff = time.Second
+	if !queue.Retry(item) {
+		t.Fatal("Expected the failed item to be retried")
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if item.Attempts() != 1 || item.Stage() != StageError {
+		t.Errorf("Expected the first backoff to be dropped, got %v after %d attempts", item.Stage(), item.Attempts())
+	}
+	queue.Remove(item)
+}
@@ -0,0 +1,79 @@
+package url
+
+import (
+	"math"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+)
+
+// RetryPolicy decides whether a failed download is attempted again and how
+// long to wait before doing so
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	ExitCodes      []int
+	StderrPatterns []*regexp.Regexp
+}
+
+// NewRetryPolicy builds a policy from its configuration
+func NewRetryPolicy(cfg config.Retry) (RetryPolicy, error) {
+	policy := RetryPolicy{
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: time.Duration(cfg.InitialBackoff),
+		MaxBackoff:     time.Duration(cfg.MaxBackoff),
+		Multiplier:     cfg.Multiplier,
+		ExitCodes:      slices.Clone(cfg.ExitCodes),
+	}
+
+	for _, pattern := range cfg.StderrPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return RetryPolicy{}, err
+		}
+		policy.StderrPatterns = append(policy.StderrPatterns, re)
+	}
+
+	return policy, nil
+}
+
+// Retryable returns true if the failure looks transient. Start failures and
+// user cancellations are never retried.
+func (p RetryPolicy) Retryable(failure *Failure) bool {
+	if failure == nil || failure.Kind == FailureStart || failure.Kind == FailureCancelled {
+		return false
+	}
+
+	if failure.Kind == FailureExit && slices.Contains(p.ExitCodes, failure.ExitCode) {
+		return true
+	}
+
+	for _, line := range failure.Stderr {
+		for _, re := range p.StderrPatterns {
+			if re.MatchString(line) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ShouldRetry returns true if a download that failed after the given number
+// of attempts must be attempted again
+func (p RetryPolicy) ShouldRetry(failure *Failure, attempts int) bool {
+	return attempts < p.MaxAttempts && p.Retryable(failure)
+}
+
+// Backoff returns the delay before the attempt following the given one
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(max(p.Multiplier, 1), float64(max(attempt-1, 0)))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
@@ -0,0 +1,108 @@
+package url
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy, err := NewRetryPolicy(config.Retry{
+		MaxAttempts:    3,
+		InitialBackoff: config.Duration(time.Second),
+		MaxBackoff:     config.Duration(3 * time.Second),
+		Multiplier:     2,
+		ExitCodes:      []int{101},
+		StderrPatterns: []string{`HTTP Error 5\d\d`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("retryable", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			failure  *Failure
+			expected bool
+		}{
+			{"exit_code", &Failure{Kind: FailureExit, ExitCode: 101}, true},
+			{"stderr_pattern", &Failure{Kind: FailureExit, ExitCode: 1, Stderr: []string{"ERROR: HTTP Error 503: Service Unavailable"}}, true},
+			{"permanent", &Failure{Kind: FailureExit, ExitCode: 1, Stderr: []string{"ERROR: Unsupported URL"}}, false},
+			{"start", &Failure{Kind: FailureStart, Stderr: []string{"HTTP Error 500"}}, false},
+			{"cancelled", &Failure{Kind: FailureCancelled, ExitCode: 101}, false},
+			{"nil", nil, false},
+		}
+
+		for _, c := range cases {
+			if got := policy.Retryable(c.failure); got != c.expected {
+				t.Errorf("%s: expected %v, got %v", c.name, c.expected, got)
+			}
+		}
+	})
+
+	t.Run("max_attempts", func(t *testing.T) {
+		failure := &Failure{Kind: FailureExit, ExitCode: 101}
+		if !policy.ShouldRetry(failure, 2) {
+			t.Error("Expected retry after the second attempt")
+		}
+		if policy.ShouldRetry(failure, 3) {
+			t.Error("Expected no retry after the last attempt")
+		}
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		expected := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+		for idx, want := range expected {
+			if got := policy.Backoff(idx + 1); got != want {
+				t.Errorf("Backoff(%d): expected %v, got %v", idx+1, want, got)
+			}
+		}
+	})
+}
+
+func TestQueue_Retry(t *testing.T) {
+	attempts := 0
+	mockExecutor := NewMockCommandExecutor()
+	mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+		attempts++
+		cmd := &MockCommand{Name: name, Args: args, Process: &os.Process{}, waitDuration: 10 * time.Millisecond}
+		if attempts == 1 {
+			cmd.SetExitCode(1).SetStderrData("ERROR: HTTP Error 502: Bad Gateway\n")
+		}
+		return cmd
+	}
+
+	urlItem := NewUrlItemEx("https://example.com/video", mockExecutor)
+	urlItem.Retry = RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: 50 * time.Millisecond,
+		Multiplier:     2,
+		ExitCodes:      []int{1},
+	}
+
+	queue := NewQueue(1)
+	queue.Add(urlItem)
+
+	time.Sleep(30 * time.Millisecond)
+
+	if urlItem.Stage() != StageError {
+		t.Fatalf("Expected first attempt to fail, got %v", urlItem.Stage())
+	}
+	if urlItem.NextRetryAt().IsZero() {
+		t.Error("Expected a retry to be scheduled")
+	}
+
+	time.Sleep(80 * time.Millisecond)
+
+	if urlItem.Stage() != StageCompleted {
+		t.Errorf("Expected retry to complete, got %v", urlItem.Stage())
+	}
+	if urlItem.Attempts() != 2 {
+		t.Errorf("Expected 2 attempts, got %d", urlItem.Attempts())
+	}
+	if !urlItem.NextRetryAt().IsZero() {
+		t.Error("Expected next retry to be cleared")
+	}
+}
@@ -0,0 +1,127 @@
+package url
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+type DownloadStage int
+
+const (
+	StageNotStarted DownloadStage = iota
+	StageQueued
+	StagePaused
+	StageDownloading
+	StageProcessing
+	StageCompleted
+	StageError
+	// StageArchived marks items found in the download archive, which yt-dlp
+	// would skip since they were already downloaded
+	StageArchived
+)
+
+var stageNames = [...]string{
+	"Not Started",
+	"Queued",
+	"Paused",
+	"Downloading",
+	"Processing",
+	"Completed",
+	"Error",
+	"Archived",
+}
+
+func (s DownloadStage) String() string {
+	if s < StageNotStarted || s > StageArchived {
+		return "Unknown"
+	}
+
+	return stageNames[s]
+}
+
+func (s DownloadStage) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *DownloadStage) UnmarshalText(text []byte) error {
+	for idx, name := range stageNames {
+		if name == string(text) {
+			*s = DownloadStage(idx)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown download stage %q", text)
+}
+
+// Running returns true for the stages holding a yt-dlp process
+func (s DownloadStage) Running() bool {
+	return s == StageDownloading || s == StageProcessing
+}
+
+// stageTransitions lists the stages each stage may move to
+var stageTransitions = map[DownloadStage][]DownloadStage{
+	StageNotStarted:  {StageQueued, StageDownloading, StageError, StageArchived},
+	StageQueued:      {StagePaused, StageDownloading, StageError, StageArchived},
+	StagePaused:      {StageQueued, StageDownloading, StageError},
+	StageDownloading: {StageProcessing, StagePaused, StageCompleted, StageError},
+	StageProcessing:  {StagePaused, StageCompleted, StageError, StageArchived},
+	StageCompleted:   {StageQueued, StageDownloading, StageError},
+	StageError:       {StageQueued, StageDownloading},
+	StageArchived:    {StageQueued, StageDownloading},
+}
+
+// CanTransition returns true if the state machine allows moving from s to stage
+func (s DownloadStage) CanTransition(stage DownloadStage) bool {
+	return slices.Contains(stageTransitions[s], stage)
+}
+
+// ErrInvalidTransition is returned when a stage change is not allowed
+type ErrInvalidTransition struct {
+	From DownloadStage
+	To   DownloadStage
+}
+
+func (e *ErrInvalidTransition) Error() string {
+	return fmt.Sprintf("invalid stage transition from %s to %s", e.From, e.To)
+}
+
+// Stage returns the current stage of the item
+func (u *UrlItem) Stage() DownloadStage {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.stage
+}
+
+// setStageLocked moves the item to stage and publishes the change, u.mutex
+// must be held
+func (u *UrlItem) setStageLocked(stage DownloadStage) error {
+	if u.stage == stage {
+		return nil
+	}
+	if !u.stage.CanTransition(stage) {
+		return &ErrInvalidTransition{From: u.stage, To: stage}
+	}
+
+	from := u.stage
+	u.stage = stage
+	u.publish(Event{Type: EventStageChanged, From: from, To: stage, At: time.Now()})
+	return nil
+}
+
+func (u *UrlItem) setStage(stage DownloadStage) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.setStageLocked(stage)
+}
+
+// setStageFrom moves the item to stage only if it currently is in from
+func (u *UrlItem) setStageFrom(from DownloadStage, stage DownloadStage) bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if u.stage != from {
+		return false
+	}
+	return u.setStageLocked(stage) == nil
+}
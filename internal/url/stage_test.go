@@ -0,0 +1,56 @@
+package url
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDownloadStage_Transitions(t *testing.T) {
+	cases := []struct {
+		from     DownloadStage
+		to       DownloadStage
+		expected bool
+	}{
+		{StageNotStarted, StageQueued, true},
+		{StageQueued, StageDownloading, true},
+		{StageDownloading, StageProcessing, true},
+		{StageProcessing, StageCompleted, true},
+		{StageDownloading, StagePaused, true},
+		{StagePaused, StageQueued, true},
+		{StageError, StageQueued, true},
+		{StageNotStarted, StageCompleted, false},
+		{StageQueued, StageCompleted, false},
+		{StageCompleted, StagePaused, false},
+		{StagePaused, StageProcessing, false},
+	}
+
+	for _, c := range cases {
+		if got := c.from.CanTransition(c.to); got != c.expected {
+			t.Errorf("%s -> %s: expected %v, got %v", c.from, c.to, c.expected, got)
+		}
+	}
+}
+
+func TestUrlItem_SetStage(t *testing.T) {
+	urlItem := NewUrlItemEx("https://example.com/video", NewMockCommandExecutor())
+
+	err := urlItem.setStage(StageCompleted)
+
+	var invalid *ErrInvalidTransition
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Expected ErrInvalidTransition, got %v", err)
+	}
+	if invalid.From != StageNotStarted || invalid.To != StageCompleted {
+		t.Errorf("Unexpected transition error %v", invalid)
+	}
+	if urlItem.Stage() != StageNotStarted {
+		t.Errorf("Expected stage to be unchanged, got %v", urlItem.Stage())
+	}
+
+	if urlItem.setStageFrom(StagePaused, StageQueued) {
+		t.Error("Expected setStageFrom to fail from another stage")
+	}
+	if !urlItem.setStageFrom(StageNotStarted, StageQueued) {
+		t.Error("Expected setStageFrom to succeed")
+	}
+}
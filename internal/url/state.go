@@ -0,0 +1,102 @@
+package url
+
+import (
+	"slices"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+)
+
+// ItemState is the part of an UrlItem that survives a restart
+type ItemState struct {
+	ID         string        `json:"id,omitempty"`
+	Url        string        `json:"url"`
+	Stage      DownloadStage `json:"stage"`
+	StartedAt  time.Time     `json:"started_at"`
+	StoppedAt  time.Time     `json:"stopped_at"`
+	Profile    string        `json:"profile,omitempty"`
+	Options    []string      `json:"options,omitempty"`
+	OutputPath string        `json:"output_path,omitempty"`
+	Failure    *Failure      `json:"failure,omitempty"`
+	Attempts   int           `json:"attempts,omitempty"`
+	LogFile    string        `json:"log_file,omitempty"`
+	Metadata   *Metadata     `json:"metadata,omitempty"`
+	Format     FormatChoice  `json:"format"`
+	Group      *Group        `json:"group,omitempty"`
+	// NextRetryAt is set when the item was waiting to be retried
+	NextRetryAt time.Time `json:"next_retry_at,omitempty"`
+}
+
+// State returns the persistable state of the item
+func (u *UrlItem) State() ItemState {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	var group *Group
+	if u.Group.Url != "" {
+		g := u.Group
+		group = &g
+	}
+
+	return ItemState{
+		ID:          u.id,
+		Url:         u.Url,
+		Stage:       u.stage,
+		StartedAt:   u.startedAt,
+		StoppedAt:   u.stoppedAt,
+		Profile:     u.Profile.Name,
+		Options:     slices.Clone(u.Options),
+		OutputPath:  u.Progress().Filename,
+		Failure:     u.failure,
+		Attempts:    u.attempts,
+		LogFile:     u.logFile,
+		Metadata:    u.metadata.Summary(),
+		Format:      u.format,
+		Group:       group,
+		NextRetryAt: u.nextRetryAt,
+	}
+}
+
+// NewUrlItemFromState rebuilds an item saved with State using cfg and the
+// profile it names. Downloads that were interrupted or waiting to be retried
+// are put back in StageQueued so yt-dlp can resume their .part files.
+func NewUrlItemFromState(state ItemState, cfg config.Config, executor CommandExecutor) (*UrlItem, error) {
+	item := NewUrlItemEx(state.Url, executor)
+	// states saved before items had ids keep the generated one
+	if state.ID != "" {
+		item.id = state.ID
+	}
+
+	profile, _ := cfg.Profile(state.Profile)
+	if err := item.ApplyConfig(cfg, profile); err != nil {
+		return nil, err
+	}
+
+	item.Options = slices.Clone(state.Options)
+	item.startedAt = state.StartedAt
+	item.stoppedAt = state.StoppedAt
+	item.failure = state.Failure
+	item.attempts = state.Attempts
+	item.logFile = state.LogFile
+	item.metadata = state.Metadata
+	item.format = state.Format
+	if state.Group != nil {
+		item.Group = *state.Group
+	}
+	item.progress.current.Filename = state.OutputPath
+
+	// the item is not shared yet, so the stage is set without a transition
+	switch {
+	case state.Stage == StagePaused:
+		item.paused.Store(state.Attempts > 0)
+		item.stage = StagePaused
+	case state.Stage == StageError && !state.NextRetryAt.IsZero():
+		item.stage = StageQueued
+	case state.Stage == StageCompleted, state.Stage == StageError:
+		item.stage = state.Stage
+	default:
+		item.stage = StageQueued
+	}
+
+	return item, nil
+}
@@ -1,151 +1,486 @@
 package url
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
-)
-
-type DownloadStage int
 
-const (
-	StageNotStarted DownloadStage = iota
-	StageDownloading
-	StageProcessing
-	StageCompleted
-	StageError
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
 )
 
-func (s DownloadStage) String() string {
-	stages := [...]string{
-		"Not Started",
-		"Downloading",
-		"Processing",
-		"Completed",
-		"Error",
-	}
+// stopTimeout is how long Stop waits for yt-dlp to exit after SIGINT
+// before killing it
+const stopTimeout = 30 * time.Second
 
-	if s < StageNotStarted || s > StageError {
-		return "Unknown"
-	}
+// UrlItem is a single yt-dlp download. The exported fields configure the
+// download and must not be changed while it runs, its lifecycle is exposed
+// through the accessor methods which are safe for concurrent use.
+type UrlItem struct {
+	Url     string
+	Config  config.Config
+	Profile config.Profile
+	Options []string
+	Retry   RetryPolicy
+	// Group is set on the items expanded from a playlist
+	Group Group
 
-	return stages[s]
-}
+	id          string
+	mutex       sync.RWMutex
+	stage       DownloadStage
+	startedAt   time.Time
+	stoppedAt   time.Time
+	failure     *Failure
+	attempts    int
+	nextRetryAt time.Time
+	cmd         Command
+	done        chan struct{}
+	logFile     string
+	metadata    *Metadata
+	format      FormatChoice
 
-type UrlItem struct {
-	Url       string
-	cmd       Command
-	Stdout    io.ReadCloser
-	StdoutBuf chan []byte
-	Stderr    io.ReadCloser
-	StderrBuf chan []byte
-	Recording DownloadStage
-	Logging   bool
-	StartedAt time.Time
-	StoppedAt time.Time
 	executor  CommandExecutor
+	bus       atomic.Pointer[Bus]
+	progress  progressTracker
+	stderr    lineTail
+	logs      *LogBuffer
+	cancelled atomic.Bool
+	paused    atomic.Bool
+	archived  atomic.Bool
+}
+
+// newItemID returns a random identifier, saved with the item so it stays
+// the same across runs
+func newItemID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
 }
 
 func NewUrlItem(url string) *UrlItem {
 	return &UrlItem{
+		id:       newItemID(),
 		Url:      url,
+		Config:   config.Default(),
+		stderr:   lineTail{size: stderrTailSize},
+		logs:     NewLogBuffer(config.Default().LogLines),
 		executor: &RealCommandExecutor{},
 	}
 }
 
 func NewUrlItemEx(url string, executor CommandExecutor) *UrlItem {
 	return &UrlItem{
+		id:       newItemID(),
 		Url:      url,
+		Config:   config.Default(),
+		stderr:   lineTail{size: stderrTailSize},
+		logs:     NewLogBuffer(config.Default().LogLines),
 		executor: executor,
 	}
 }
 
+// ApplyConfig sets the config and profile used by the next Start, along with
+// the retry policy they define
+func (u *UrlItem) ApplyConfig(cfg config.Config, profile config.Profile) error {
+	retry, err := NewRetryPolicy(cfg.RetryFor(profile))
+	if err != nil {
+		return err
+	}
+
+	u.Config = cfg
+	u.Profile = profile
+	u.Retry = retry
+	if len(u.logs.Lines()) == 0 {
+		u.logs = NewLogBuffer(cfg.LogLines)
+	}
+	return nil
+}
+
+// ID identifies the item, it is kept when the item is saved and restored
+func (u *UrlItem) ID() string {
+	return u.id
+}
+
+// Done returns a channel closed once the yt-dlp process launched by the last
+// call to Start has exited, or nil if it was never started
+func (u *UrlItem) Done() <-chan struct{} {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.done
+}
+
+func (u *UrlItem) StartedAt() time.Time {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.startedAt
+}
+
+func (u *UrlItem) StoppedAt() time.Time {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.stoppedAt
+}
+
+// Failure returns why the item is in StageError, or nil
+func (u *UrlItem) Failure() *Failure {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.failure
+}
+
+// Attempts returns how many times the download was started, resuming a
+// paused download does not count as a new attempt
+func (u *UrlItem) Attempts() int {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.attempts
+}
+
+// NextRetryAt returns when a failed item will be retried, or the zero time
+func (u *UrlItem) NextRetryAt() time.Time {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.nextRetryAt
+}
+
+func (u *UrlItem) setNextRetryAt(at time.Time) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.nextRetryAt = at
+}
+
+// resetAttempts starts the retry policy over for a failed item queued again
+func (u *UrlItem) resetAttempts() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.attempts = 0
+	u.nextRetryAt = time.Time{}
+}
+
+// Logs returns the output of the item, kept across attempts
+func (u *UrlItem) Logs() *LogBuffer {
+	return u.logs
+}
+
+// LogFile returns the path of the file the output is written to, if any
+func (u *UrlItem) LogFile() string {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.logFile
+}
+
+// StderrTail returns the last lines yt-dlp wrote to stderr
+func (u *UrlItem) StderrTail() []string {
+	return u.stderr.Lines()
+}
+
+// Progress returns a snapshot of the latest progress reported by yt-dlp
+func (u *UrlItem) Progress() Progress {
+	return u.progress.Snapshot()
+}
+
+// publish sends the event on the bus of the queue owning the item, if any
+func (u *UrlItem) publish(event Event) {
+	if bus := u.bus.Load(); bus != nil {
+		event.Item = u
+		bus.Publish(event)
+	}
+}
+
+// Start launches yt-dlp unless the item is already running
 func (u *UrlItem) Start() {
-	u.cmd = u.executor.CreateCommand("yt-dlp", "-f", "best[height<=1080]", "--fixup", "warn", "-4", u.Url)
-	u.Stdout, _ = u.cmd.StdoutPipe()
-	u.Stderr, _ = u.cmd.StderrPipe()
+	u.start()
+}
 
-	u.StdoutBuf = make(chan []byte, 1)
-	u.StderrBuf = make(chan []byte, 1)
+// start launches yt-dlp if the item is in one of the from stages, or in any
+// stage but a running one when from is empty. It returns false if the item
+// was not in an eligible stage.
+func (u *UrlItem) start(from ...DownloadStage) bool {
+	var err error
 
-	err := u.cmd.Start()
-	if err != nil {
-		return
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if u.stage.Running() || (len(from) > 0 && !slices.Contains(from, u.stage)) {
+		return false
+	}
+
+	resuming := u.paused.Swap(false)
+
+	u.done = nil
+	u.failure = nil
+	if !resuming {
+		u.attempts++
 	}
+	u.nextRetryAt = time.Time{}
+	u.cancelled.Store(false)
+	u.archived.Store(false)
+	u.stderr.Reset()
+	u.progress.Reset()
+
+	args := u.Config.CommandArgs()
+	args = append(args, u.Profile.Args...)
+	if selector := u.format.Selector(); selector != "" {
+		args = append(args, "-f", selector)
+	}
+	// the output is piped, so yt-dlp is asked for the colors the logs view shows
+	args = append(args, "--newline", "--color", "always", "--progress-template", ProgressTemplate)
+	if resuming {
+		args = append(args, "--continue")
+	}
+	args = append(args, u.Options...)
+	args = append(args, u.Url)
+
+	var stdout, stderr io.ReadCloser
+	u.cmd = u.executor.CreateCommand(u.Config.Binary, args...)
+	if stdout, err = u.cmd.StdoutPipe(); err != nil {
+		u.startFailedLocked(err)
+		return true
+	}
+	if stderr, err = u.cmd.StderrPipe(); err != nil {
+		u.startFailedLocked(err)
+		return true
+	}
+
+	if err = u.cmd.Start(); err != nil {
+		u.startFailedLocked(err)
+		return true
+	}
+
+	done := make(chan struct{})
+	cmd := u.cmd
+
+	u.openLogFileLocked()
+	u.done = done
+	u.startedAt = time.Now()
+	u.stoppedAt = time.Time{}
+	_ = u.setStageLocked(StageDownloading)
+	u.publish(Event{Type: EventStarted})
 
-	u.StartedAt = time.Now()
-	u.Recording = StageDownloading
-	u.Logging = false
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
-		err := u.cmd.Wait()
+		defer close(done)
 
-		u.Recording = StageProcessing
+		// all reads from the pipes must complete before calling Wait
 		wg.Wait()
-		close(u.StdoutBuf)
-		close(u.StderrBuf)
+		err := cmd.Wait()
+
+		_ = u.setStage(StageProcessing)
+		if err := u.logs.SetWriter(nil); err != nil {
+			log.Println(err)
+		}
+
+		failure := u.exitFailure(cmd, err)
 
-		u.StoppedAt = time.Now()
+		u.mutex.Lock()
+		defer u.mutex.Unlock()
 
+		u.stoppedAt = time.Now()
 		switch {
-		case err != nil:
-			u.Recording = StageError
-		case u.cmd.GetProcessState() != nil && u.cmd.GetProcessState().Exited():
-			u.Recording = StageCompleted
+		case failure != nil && u.paused.Load():
+			_ = u.setStageLocked(StagePaused)
+		case failure != nil:
+			u.failure = failure
+			_ = u.setStageLocked(StageError)
+			u.publish(Event{Type: EventFailed, Failure: failure})
+		case u.archived.Load():
+			u.paused.Store(false)
+			_ = u.setStageLocked(StageArchived)
+			u.publish(Event{Type: EventFinished})
+		default:
+			u.paused.Store(false)
+			_ = u.setStageLocked(StageCompleted)
+			u.publish(Event{Type: EventFinished})
 		}
 	}()
 
-	sendReadToBuffer := func(bufCh chan<- []byte, reader io.Reader) {
+	sendReadToBuffer := func(reader io.Reader, stream Stream, tail *lineTail) {
 		defer wg.Done()
-		buffer := make([]byte, 1000)
-		for u.Recording == StageDownloading {
-			_, _ = reader.Read(buffer)
-			if u.Logging {
-				bufCh <- buffer
+		scanner := bufio.NewScanner(reader)
+		scanner.Split(scanLines)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				continue
+			}
+			// progress lines only go to the log file, they would flood the buffer
+			if isProgressLine(line) {
+				u.logs.Mirror(stream, line)
+			} else {
+				u.publish(Event{Type: EventLogLine, Log: u.logs.Append(stream, line)})
+			}
+			if u.progress.Parse(line) {
+				u.publish(Event{Type: EventProgress, Progress: u.progress.Snapshot()})
+			}
+			// the colors are kept for the logs view only
+			plain := stripSGR(line)
+			if tail != nil {
+				tail.Add(plain)
+			}
+			if strings.Contains(plain, archivedLine) {
+				u.archived.Store(true)
 			}
 		}
 	}
-	go sendReadToBuffer(u.StdoutBuf, u.Stdout)
-	go sendReadToBuffer(u.StderrBuf, u.Stderr)
+	go sendReadToBuffer(stdout, StreamStdout, nil)
+	go sendReadToBuffer(stderr, StreamStderr, &u.stderr)
+
+	return true
 }
 
+// openLogFileLocked mirrors the output to a file in Config.LogDir, reusing the
+// file of previous attempts, u.mutex must be held
+func (u *UrlItem) openLogFileLocked() {
+	if u.Config.LogDir == "" {
+		return
+	}
+
+	if u.logFile == "" {
+		u.logFile = filepath.Join(u.Config.LogDir, logFileName(u.Url, time.Now()))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(u.logFile), 0o755); err != nil {
+		log.Println(err)
+		return
+	}
+
+	file, err := os.OpenFile(u.logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := u.logs.SetWriter(file); err != nil {
+		log.Println(err)
+	}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// logFileName derives a readable file name from the url and the time the
+// download first started
+func logFileName(rawUrl string, at time.Time) string {
+	name := unsafeFileChars.ReplaceAllString(rawUrl, "_")
+	name = strings.Trim(name, "_")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	return fmt.Sprintf("%s-%s.log", at.Format("20060102-150405"), name)
+}
+
+// startFailedLocked records a failure to launch yt-dlp, u.mutex must be held
+func (u *UrlItem) startFailedLocked(err error) {
+	u.startedAt = time.Now()
+	u.stoppedAt = u.startedAt
+	u.failure = &Failure{Kind: FailureStart, Err: err.Error()}
+	_ = u.setStageLocked(StageError)
+	u.publish(Event{Type: EventFailed, Failure: u.failure})
+}
+
+// exitFailure inspects how the process ended, it returns nil on success
+func (u *UrlItem) exitFailure(cmd Command, err error) *Failure {
+	failure := &Failure{Stderr: u.stderr.Lines()}
+
+	state := cmd.GetProcessState()
+	switch {
+	case state != nil && state.Signal() != nil:
+		failure.Kind = FailureSignal
+		failure.Signal = state.Signal().String()
+	case state != nil && state.ExitCode() != 0:
+		failure.Kind = FailureExit
+		failure.ExitCode = state.ExitCode()
+	case err != nil:
+		failure.Kind = FailureExit
+		failure.Err = err.Error()
+	default:
+		return nil
+	}
+
+	if u.cancelled.Load() {
+		failure.Kind = FailureCancelled
+	}
+
+	return failure
+}
+
+// scanLines is a bufio.SplitFunc that treats both '\n' and '\r' as line
+// terminators, since yt-dlp redraws progress lines using carriage returns
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Stop interrupts the running process and waits for it to exit
 func (u *UrlItem) Stop() {
 	var err error
 
-	if u.cmd.GetProcess() == nil {
+	u.mutex.RLock()
+	cmd, done := u.cmd, u.done
+	u.mutex.RUnlock()
+
+	if cmd == nil || cmd.GetProcess() == nil || done == nil {
 		return
 	}
 
-	if u.cmd.GetProcessState() != nil && u.cmd.GetProcessState().Exited() {
-		u.Recording = StageCompleted
+	if cmd.GetProcessState() != nil {
+		<-done
 		return
 	}
 
-	err = u.cmd.GetProcess().Signal(syscall.SIGINT)
+	u.cancelled.Store(true)
+	err = cmd.GetProcess().Signal(syscall.SIGINT)
 	if err != nil {
 		log.Println(err)
 	}
 
-	backoff := 1 * time.Second
-	maxBackoff := 30 * time.Minute
-	for u.Recording == StageProcessing {
-		if u.cmd.GetProcessState() != nil && u.cmd.GetProcessState().Exited() {
-			u.Recording = StageCompleted
-			return
+	select {
+	case <-done:
+	case <-time.After(stopTimeout):
+		if err := cmd.GetProcess().Kill(); err != nil {
+			log.Println(err)
 		}
+		<-done
+	}
+}
 
-		if backoff < maxBackoff {
-			backoff *= 2
-		} else {
-			u.Recording = StageCompleted
-			return
-		}
-		time.Sleep(backoff)
+// Pause stops a running download keeping its partial file, the next call to
+// Start resumes it with --continue
+func (u *UrlItem) Pause() {
+	if u.Stage() != StageDownloading {
+		return
 	}
+
+	u.paused.Store(true)
+	u.Stop()
+}
+
+// Paused returns true if the item was paused and its next Start resumes it
+func (u *UrlItem) Paused() bool {
+	return u.paused.Load()
 }
 
 type ByComplete []*UrlItem
@@ -153,5 +488,5 @@ type ByComplete []*UrlItem
 func (a ByComplete) Len() int      { return len(a) }
 func (a ByComplete) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
 func (a ByComplete) Less(i, j int) bool {
-	return a[i].Recording > a[j].Recording
+	return a[i].Stage() > a[j].Stage()
 }
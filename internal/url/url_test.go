@@ -2,9 +2,15 @@ package url
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
 	"slices"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
 )
 
 // TestUrlItem_Start_Basic tests basic functionality
@@ -24,11 +30,11 @@ func TestUrlItem_Start_Basic(t *testing.T) {
 			t.Error("URL not found in command arguments")
 		}
 
-		if urlItem.Recording != StageDownloading {
-			t.Errorf("Expected stage StageDownloading, got %v", urlItem.Recording)
+		if urlItem.Stage() != StageDownloading {
+			t.Errorf("Expected stage StageDownloading, got %v", urlItem.Stage())
 		}
 
-		if urlItem.StartedAt.IsZero() {
+		if urlItem.StartedAt().IsZero() {
 			t.Error("StartedAt should be set")
 		}
 	})
@@ -73,8 +79,16 @@ func TestUrlItem_Start_PreConfiguredMocks(t *testing.T) {
 		urlItem := NewUrlItemEx("https://example.com/video", mockExecutor)
 		urlItem.Start()
 
-		if urlItem.Recording != StageNotStarted {
-			t.Errorf("Expected stage StageNotStarted on start failure, got %v", urlItem.Recording)
+		if urlItem.Stage() != StageError {
+			t.Errorf("Expected stage StageError on start failure, got %v", urlItem.Stage())
+		}
+
+		if urlItem.Failure() == nil || urlItem.Failure().Kind != FailureStart {
+			t.Fatalf("Expected start failure, got %+v", urlItem.Failure())
+		}
+
+		if urlItem.Failure().Err != "command not found" {
+			t.Errorf("Expected start error 'command not found', got '%s'", urlItem.Failure().Err)
 		}
 	})
 
@@ -101,8 +115,8 @@ func TestUrlItem_Start_PreConfiguredMocks(t *testing.T) {
 
 		time.Sleep(100 * time.Millisecond)
 
-		if urlItem.Recording != StageError {
-			t.Errorf("Expected stage StageError on wait failure, got %v", urlItem.Recording)
+		if urlItem.Stage() != StageError {
+			t.Errorf("Expected stage StageError on wait failure, got %v", urlItem.Stage())
 		}
 	})
 
@@ -129,11 +143,11 @@ func TestUrlItem_Start_PreConfiguredMocks(t *testing.T) {
 
 		time.Sleep(100 * time.Millisecond)
 
-		if urlItem.Recording != StageCompleted {
-			t.Errorf("Expected stage StageCompleted on success, got %v", urlItem.Recording)
+		if urlItem.Stage() != StageCompleted {
+			t.Errorf("Expected stage StageCompleted on success, got %v", urlItem.Stage())
 		}
 
-		if urlItem.StoppedAt.IsZero() {
+		if urlItem.StoppedAt().IsZero() {
 			t.Error("StoppedAt should be set after completion")
 		}
 	})
@@ -147,7 +161,10 @@ func TestUrlItem_Start_ArgumentValidation(t *testing.T) {
 	urlItem.Start()
 
 	cmd := mockExecutor.Command
-	expectedArgs := []string{"-f", "best[height<=1080]", "--fixup", "warn", "-4", "https://example.com/test-video"}
+	expectedArgs := []string{
+		"-f", "best[height<=1080]", "--fixup", "warn", "-4",
+		"--newline", "--color", "always", "--progress-template", ProgressTemplate, "https://example.com/test-video",
+	}
 
 	if len(cmd.Args) != len(expectedArgs) {
 		t.Errorf("Expected %d args, got %d", len(expectedArgs), len(cmd.Args))
@@ -167,16 +184,16 @@ func TestUrlItem_StateTransition(t *testing.T) {
 		urlItem := NewUrlItemEx("https://example.com/video", mockExecutor)
 
 		stages := []DownloadStage{}
-		stages = append(stages, urlItem.Recording)
+		stages = append(stages, urlItem.Stage())
 
 		urlItem.Start()
-		stages = append(stages, urlItem.Recording)
+		stages = append(stages, urlItem.Stage())
 
 		// wait for the command to complete
 		time.Sleep(500 * time.Millisecond)
 
 		urlItem.Stop()
-		stages = append(stages, urlItem.Recording)
+		stages = append(stages, urlItem.Stage())
 
 		expectedStages := []DownloadStage{
 			StageNotStarted,
@@ -190,3 +207,315 @@ func TestUrlItem_StateTransition(t *testing.T) {
 		}
 	})
 }
+
+func TestUrlItem_State(t *testing.T) {
+	t.Run("interrupted_is_requeued", func(t *testing.T) {
+		mockExecutor := NewMockCommandExecutor()
+		urlItem := NewUrlItemEx("https://example.com/video", mockExecutor)
+		urlItem.Options = []string{"-x"}
+		urlItem.stage = StageDownloading
+		urlItem.startedAt = time.Now()
+
+		urlItem.Profile = config.Profile{Name: "audio mp3"}
+
+		restored, err := NewUrlItemFromState(urlItem.State(), config.Default(), mockExecutor)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if restored.ID() != urlItem.ID() {
+			t.Errorf("Expected id '%s', got '%s'", urlItem.ID(), restored.ID())
+		}
+		if restored.Url != urlItem.Url {
+			t.Errorf("Expected URL '%s', got '%s'", urlItem.Url, restored.Url)
+		}
+		if restored.Stage() != StageQueued {
+			t.Errorf("Expected stage StageQueued, got %v", restored.Stage())
+		}
+		if !slices.Equal(restored.Options, urlItem.Options) {
+			t.Errorf("Expected options %v, got %v", urlItem.Options, restored.Options)
+		}
+		if restored.Profile.Name != "audio mp3" || len(restored.Profile.Args) == 0 {
+			t.Errorf("Expected profile to be resolved from config, got %+v", restored.Profile)
+		}
+	})
+
+	t.Run("finished_keeps_stage", func(t *testing.T) {
+		state := ItemState{
+			Url:     "https://example.com/video",
+			Stage:   StageError,
+			Failure: &Failure{Kind: FailureExit, ExitCode: 1},
+		}
+		restored, err := NewUrlItemFromState(state, config.Default(), NewMockCommandExecutor())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if restored.Stage() != StageError {
+			t.Errorf("Expected stage StageError, got %v", restored.Stage())
+		}
+		if restored.ID() == "" {
+			t.Error("Expected an id for a state saved without one")
+		}
+		if restored.Failure() == nil || restored.Failure().ExitCode != 1 {
+			t.Errorf("Expected failure to be restored, got %+v", restored.Failure())
+		}
+	})
+
+	t.Run("pending_retry_is_requeued", func(t *testing.T) {
+		state := ItemState{
+			Url:         "https://example.com/video",
+			Stage:       StageError,
+			Attempts:    1,
+			NextRetryAt: time.Now().Add(time.Minute),
+		}
+		restored, err := NewUrlItemFromState(state, config.Default(), NewMockCommandExecutor())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if restored.Stage() != StageQueued {
+			t.Errorf("Expected stage StageQueued, got %v", restored.Stage())
+		}
+		if restored.Attempts() != 1 {
+			t.Errorf("Expected 1 attempt, got %d", restored.Attempts())
+		}
+		if restored.Retry.MaxAttempts != config.DefaultRetry().MaxAttempts {
+			t.Errorf("Expected default retry policy, got %+v", restored.Retry)
+		}
+	})
+
+	t.Run("formats_not_saved", func(t *testing.T) {
+		urlItem := NewUrlItemEx("https://example.com/video", NewMockCommandExecutor())
+		urlItem.metadata = &Metadata{Title: "Video", Formats: []Format{{ID: "137"}, {ID: "140"}}}
+
+		state := urlItem.State()
+		if state.Metadata == nil || state.Metadata.Title != "Video" || len(state.Metadata.Formats) != 0 {
+			t.Errorf("Expected the title without the formats, got %+v", state.Metadata)
+		}
+		if len(urlItem.Metadata().Formats) != 2 {
+			t.Error("Expected the formats to be kept on the item")
+		}
+	})
+
+	t.Run("stage_text", func(t *testing.T) {
+		text, _ := StageCompleted.MarshalText()
+
+		var stage DownloadStage
+		if err := stage.UnmarshalText(text); err != nil || stage != StageCompleted {
+			t.Errorf("Expected StageCompleted, got %v (%v)", stage, err)
+		}
+		if err := stage.UnmarshalText([]byte("bogus")); err == nil {
+			t.Error("Expected error for unknown stage")
+		}
+	})
+}
+
+func TestUrlItem_Start_Config(t *testing.T) {
+	mockExecutor := NewMockCommandExecutor()
+	urlItem := NewUrlItemEx("https://example.com/video", mockExecutor)
+	urlItem.Config = config.Config{
+		Binary:    "/opt/bin/yt-dlp",
+		Args:      []string{"-x"},
+		OutputDir: "/downloads",
+	}
+	urlItem.Profile = config.Profile{Name: "audio", Args: []string{"-f", "bestaudio"}}
+	urlItem.Options = []string{"--audio-format", "mp3"}
+
+	urlItem.Start()
+
+	cmd := mockExecutor.Command
+	if cmd.Name != "/opt/bin/yt-dlp" {
+		t.Errorf("Expected command name '/opt/bin/yt-dlp', got '%s'", cmd.Name)
+	}
+
+	expectedArgs := []string{
+		"-x", "--paths", "/downloads", "-f", "bestaudio",
+		"--newline", "--color", "always", "--progress-template", ProgressTemplate,
+		"--audio-format", "mp3", "https://example.com/video",
+	}
+	if !slices.Equal(cmd.Args, expectedArgs) {
+		t.Errorf("Expected args %v, got %v", expectedArgs, cmd.Args)
+	}
+}
+
+func TestUrlItem_Failure(t *testing.T) {
+	newFailingItem := func(cmd *MockCommand) *UrlItem {
+		mockExecutor := NewMockCommandExecutor()
+		mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+			cmd.Name = name
+			cmd.Args = args
+			return cmd
+		}
+		return NewUrlItemEx("https://example.com/video", mockExecutor)
+	}
+
+	t.Run("exit_code", func(t *testing.T) {
+		cmd := (&MockCommand{Process: &os.Process{}}).
+			SetExitCode(2).
+			SetWaitError(errors.New("exit status 2")).
+			SetStderrData("WARNING: something\nERROR: Unsupported URL\n").
+			SetWaitDuration(10 * time.Millisecond)
+		urlItem := newFailingItem(cmd)
+
+		urlItem.Start()
+		<-urlItem.Done()
+
+		if urlItem.Stage() != StageError {
+			t.Fatalf("Expected stage StageError, got %v", urlItem.Stage())
+		}
+		if urlItem.Failure().Kind != FailureExit || urlItem.Failure().ExitCode != 2 {
+			t.Errorf("Expected exit failure with code 2, got %+v", urlItem.Failure())
+		}
+		if urlItem.Failure().String() != "exited with code 2" {
+			t.Errorf("Unexpected failure text '%s'", urlItem.Failure().String())
+		}
+
+		expectedStderr := []string{"WARNING: something", "ERROR: Unsupported URL"}
+		if !slices.Equal(urlItem.Failure().Stderr, expectedStderr) {
+			t.Errorf("Expected stderr %v, got %v", expectedStderr, urlItem.Failure().Stderr)
+		}
+	})
+
+	t.Run("signal", func(t *testing.T) {
+		cmd := (&MockCommand{Process: &os.Process{}}).
+			SetSignal(syscall.SIGKILL).
+			SetWaitError(errors.New("signal: killed")).
+			SetWaitDuration(10 * time.Millisecond)
+		urlItem := newFailingItem(cmd)
+
+		urlItem.Start()
+		<-urlItem.Done()
+
+		if urlItem.Failure() == nil || urlItem.Failure().Kind != FailureSignal {
+			t.Fatalf("Expected signal failure, got %+v", urlItem.Failure())
+		}
+		if urlItem.Failure().Signal != syscall.SIGKILL.String() {
+			t.Errorf("Expected signal '%s', got '%s'", syscall.SIGKILL, urlItem.Failure().Signal)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		cmd := (&MockCommand{Process: &os.Process{}}).
+			SetExitCode(1).
+			SetWaitError(errors.New("exit status 1")).
+			SetWaitDuration(50 * time.Millisecond)
+		urlItem := newFailingItem(cmd)
+
+		urlItem.Start()
+		urlItem.Stop()
+
+		if urlItem.Failure() == nil || urlItem.Failure().Kind != FailureCancelled {
+			t.Fatalf("Expected cancelled failure, got %+v", urlItem.Failure())
+		}
+	})
+
+	t.Run("stop_keeps_error", func(t *testing.T) {
+		cmd := (&MockCommand{Process: &os.Process{}}).
+			SetExitCode(1).
+			SetWaitDuration(10 * time.Millisecond)
+		urlItem := newFailingItem(cmd)
+
+		urlItem.Start()
+		<-urlItem.Done()
+		urlItem.Stop()
+
+		if urlItem.Stage() != StageError {
+			t.Errorf("Expected stage StageError after stopping a failed item, got %v", urlItem.Stage())
+		}
+	})
+}
+
+func TestUrlItem_PauseResume(t *testing.T) {
+	mockExecutor := NewMockCommandExecutor()
+	mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+		cmd := (&MockCommand{Name: name, Args: args, Process: &os.Process{}}).
+			SetExitCode(1).
+			SetWaitDuration(50 * time.Millisecond)
+		mockExecutor.Command = cmd
+		return cmd
+	}
+
+	urlItem := NewUrlItemEx("https://example.com/video", mockExecutor)
+	urlItem.Start()
+	urlItem.Pause()
+
+	if urlItem.Stage() != StagePaused {
+		t.Fatalf("Expected stage StagePaused, got %v", urlItem.Stage())
+	}
+	if urlItem.Failure() != nil {
+		t.Errorf("Expected no failure for a paused item, got %+v", urlItem.Failure())
+	}
+	if !urlItem.Paused() {
+		t.Error("Expected item to be resumable")
+	}
+
+	urlItem.Start()
+
+	if !slices.Contains(mockExecutor.Command.Args, "--continue") {
+		t.Errorf("Expected resumed command to continue the partial file, got %v", mockExecutor.Command.Args)
+	}
+	if urlItem.Attempts() != 1 {
+		t.Errorf("Expected resume not to count as an attempt, got %d", urlItem.Attempts())
+	}
+	if urlItem.Paused() {
+		t.Error("Expected pause flag to be consumed by Start")
+	}
+}
+
+func TestUrlItem_Logs(t *testing.T) {
+	mockExecutor := NewMockCommandExecutor()
+	mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+		cmd := &MockCommand{
+			Name:       name,
+			Args:       args,
+			StdoutData: "[youtube] abc: Downloading webpage\n[download]  10.0% of 10.00MiB at 1.00MiB/s ETA 00:09\n",
+			StderrData: "ERROR: unable to download\n",
+			Process:    &os.Process{},
+		}
+		cmd.SetExitCode(1)
+		mockExecutor.Command = cmd
+		return cmd
+	}
+
+	cfg := config.Default()
+	cfg.LogDir = t.TempDir()
+	cfg.LogLines = 10
+
+	urlItem := NewUrlItemEx("https://example.com/video", mockExecutor)
+	if err := urlItem.ApplyConfig(cfg, config.Profile{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		urlItem.Start()
+		<-urlItem.Done()
+	}
+
+	lines := urlItem.Logs().Lines()
+	if len(lines) != 4 {
+		t.Fatalf("Expected the output of both attempts to be kept, got %+v", lines)
+	}
+	stderrLines := slices.DeleteFunc(lines, func(line LogLine) bool { return line.Stream != StreamStderr })
+	if len(stderrLines) != 2 {
+		t.Errorf("Expected 2 stderr lines, got %+v", stderrLines)
+	}
+
+	if filepath.Dir(urlItem.LogFile()) != cfg.LogDir {
+		t.Fatalf("Expected log file in %s, got '%s'", cfg.LogDir, urlItem.LogFile())
+	}
+	data, err := os.ReadFile(urlItem.LogFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(string(data), "stderr ERROR: unable to download"); count != 2 {
+		t.Errorf("Expected both attempts in the log file, got:\n%s", data)
+	}
+	// the progress lines are kept out of the buffer only
+	if count := strings.Count(string(data), "stdout [download]  10.0%"); count != 2 {
+		t.Errorf("Expected the progress lines in the log file, got:\n%s", data)
+	}
+	if state := urlItem.State(); state.LogFile != urlItem.LogFile() {
+		t.Errorf("Expected log file to be persisted, got '%s'", state.LogFile)
+	}
+}
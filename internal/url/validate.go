@@ -0,0 +1,55 @@
+package url
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strings"
+)
+
+var (
+	ErrEmptyUrl    = errors.New("url is empty")
+	ErrInvalidHost = errors.New("url has no valid host")
+)
+
+// Validate checks that rawUrl is an http or https url with a plausible host,
+// a missing scheme is accepted since Normalize adds it
+func Validate(rawUrl string) error {
+	rawUrl = strings.TrimSpace(rawUrl)
+	if rawUrl == "" {
+		return ErrEmptyUrl
+	}
+	if strings.ContainsAny(rawUrl, " \t\n") {
+		return errors.New("url must not contain spaces")
+	}
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
+	}
+
+	parsed, err := neturl.Parse(rawUrl)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q, expected http or https", parsed.Scheme)
+	}
+
+	host := parsed.Hostname()
+	switch {
+	case host == "":
+		return ErrInvalidHost
+	case host == "localhost", net.ParseIP(host) != nil:
+		return nil
+	case !strings.Contains(host, "."), strings.HasPrefix(host, "."), strings.HasSuffix(host, "."):
+		return fmt.Errorf("%w: %q", ErrInvalidHost, host)
+	}
+	return nil
+}
+
+// Simulate asks yt-dlp whether it can download rawUrl without downloading
+// anything, only the first entry of a playlist is checked
+func Simulate(executor CommandExecutor, binary string, rawUrl string) error {
+	_, err := commandOutput(executor, binary, "--simulate", "--playlist-items", "1", "--no-warnings", rawUrl)
+	return err
+}
@@ -0,0 +1,63 @@
+package url
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		rawUrl string
+		valid  bool
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", true},
+		{"youtu.be/dQw4w9WgXcQ", true},
+		{"http://localhost:8080/video.mp4", true},
+		{"http://192.168.1.10/video.mp4", true},
+		{"", false},
+		{"   ", false},
+		{"not a url", false},
+		{"ftp://example.com/video.mp4", false},
+		{"https://", false},
+		{"https://intranet/video", false},
+		{"https://example./video", false},
+	}
+
+	for _, tt := range tests {
+		if err := Validate(tt.rawUrl); (err == nil) != tt.valid {
+			t.Errorf("%q: expected valid=%v, got error %v", tt.rawUrl, tt.valid, err)
+		}
+	}
+
+	if err := Validate(""); !errors.Is(err, ErrEmptyUrl) {
+		t.Errorf("Expected ErrEmptyUrl, got %v", err)
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	mockExecutor := NewMockCommandExecutor()
+	mockExecutor.CreateCommandFunc = func(name string, args ...string) Command {
+		cmd := (&MockCommand{Name: name, Args: args, Process: &os.Process{}}).SetWaitDuration(time.Millisecond)
+		if strings.Contains(args[len(args)-1], "missing") {
+			cmd.SetStderrData("ERROR: Unsupported URL: https://example.com/missing\n").SetExitCode(1)
+		}
+		mockExecutor.Command = cmd
+		return cmd
+	}
+
+	if err := Simulate(mockExecutor, "yt-dlp", "https://example.com/video"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if !slices.Contains(mockExecutor.Command.Args, "--simulate") {
+		t.Errorf("Expected a simulated run, got %v", mockExecutor.Command.Args)
+	}
+
+	err := Simulate(mockExecutor, "yt-dlp", "https://example.com/missing")
+	if err == nil || !strings.Contains(err.Error(), "Unsupported URL") {
+		t.Errorf("Expected the yt-dlp error, got %v", err)
+	}
+}
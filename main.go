@@ -1,15 +1,150 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/cli"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/daemon"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/storage"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
 	"github.com/blckfalcon/go-ytdlp-mngr/ui"
 )
 
 func main() {
-	var app = ui.NewApp()
+	configPath := flag.String("config", os.Getenv(config.EnvPath), "path to the config file")
+	importPath := flag.String("import", "", "queue the urls of a batch file, one per line, - for stdin")
+	profileName := flag.String("profile", "", "profile of the imported urls, the first one by default")
+	runDaemon := flag.Bool("daemon", false, "run the downloads in the background without the interface")
+	socketPath := flag.String("socket", "", "path to the socket of the daemon")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n", os.Args[0])
+		flag.PrintDefaults()
+		cli.Usage(flag.CommandLine.Output())
+	}
+	flag.Parse()
+
+	if *configPath == "" {
+		path, err := config.DefaultPath()
+		if err != nil {
+			panic(err)
+		}
+		*configPath = path
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("could not load config: %v", err)
+	}
+
+	statePath, err := storage.DefaultStatePath()
+	if err != nil {
+		panic(err)
+	}
+
+	if *socketPath == "" {
+		path, err := daemon.DefaultSocketPath()
+		if err != nil {
+			panic(err)
+		}
+		*socketPath = path
+	}
+
+	if flag.NArg() > 0 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		status := cli.Run(ctx, cli.Options{
+			Config:     cfg,
+			Store:      storage.NewFileStorage(statePath),
+			SocketPath: *socketPath,
+			Executor:   &url.RealCommandExecutor{},
+			Stdout:     os.Stdout,
+			Stderr:     os.Stderr,
+		}, flag.Args())
+		stop()
+		os.Exit(status)
+	}
+
+	if *runDaemon {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := daemon.Run(ctx, cfg, storage.NewFileStorage(statePath), *socketPath, &url.RealCommandExecutor{}); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// the interface attaches to a running daemon, and runs the downloads
+	// itself otherwise
+	var app *ui.App
+	if daemon.Running(*socketPath) {
+		client, err := daemon.Dial(*socketPath, cfg, &url.RealCommandExecutor{})
+		if err != nil {
+			log.Fatalf("could not attach to the daemon: %v", err)
+		}
+		defer client.Close()
+		app = ui.NewClientApp(cfg, client)
+	} else {
+		store := storage.NewFileStorage(statePath)
+		unlock, err := store.Lock()
+		if err != nil {
+			log.Fatalf("could not open the downloads: %v, run the daemon to share them", err)
+		}
+		defer unlock()
+		app = ui.NewApp(cfg, store)
+	}
+
+	if err := app.Restore(); err != nil {
+		log.Printf("could not restore downloads: %v", err)
+	}
+
+	if *importPath != "" {
+		importBatch(app, cfg, *importPath, *profileName)
+	}
+
+	// closing the terminal or killing the process quits as the interface
+	// does, so the downloads are saved
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		if _, ok := <-signals; ok {
+			app.Stop()
+		}
+	}()
 
 	if err := app.Run(); err != nil {
 		panic(err)
 	}
+	signal.Stop(signals)
+	close(signals)
 
 	app.CleanUp()
 }
+
+// importBatch queues the urls of the batch file at path before the interface
+// starts, the skipped entries are logged
+func importBatch(app *ui.App, cfg config.Config, path string, profileName string) {
+	var profile config.Profile
+	if profileName != "" {
+		var ok bool
+		if profile, ok = cfg.Profile(profileName); !ok {
+			log.Fatalf("unknown profile %q", profileName)
+		}
+	}
+
+	entries, err := url.ReadBatchFile(path)
+	if err != nil {
+		log.Fatalf("could not import urls: %v", err)
+	}
+
+	added, errs := app.AddBatch(entries, profile)
+	for _, err := range errs {
+		log.Printf("skipped %s: %v", path, err)
+	}
+	log.Printf("imported %d urls from %s", added, path)
+}
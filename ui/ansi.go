@@ -0,0 +1,151 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+var (
+	ansiRe    = regexp.MustCompile(`\x1b\[([0-9;]*)([A-Za-z])`)
+	controlRe = regexp.MustCompile(`[\x00-\x08\x0b-\x1f\x7f]`)
+
+	ansiColors = []string{"black", "maroon", "green", "olive", "navy", "purple", "teal", "silver"}
+	ansiBright = []string{"gray", "red", "lime", "yellow", "blue", "fuchsia", "aqua", "white"}
+)
+
+// ansiStyle is the SGR state of a line, colors are tview color names with
+// "-" standing for the default
+type ansiStyle struct {
+	fg, bg string
+	attrs  string
+}
+
+func (s ansiStyle) tag() string {
+	attrs := s.attrs
+	if attrs == "" {
+		attrs = "-"
+	}
+	return fmt.Sprintf("[%s:%s:%s]", s.fg, s.bg, attrs)
+}
+
+// translateANSI converts the SGR escape sequences of a line of yt-dlp output
+// into tview color tags, escaping the text and dropping any other control
+// sequence. fg is the color used when the line resets the foreground.
+func translateANSI(line string, fg string) string {
+	base := ansiStyle{fg: fg, bg: "-"}
+	style := base
+
+	var builder strings.Builder
+	if fg != "-" {
+		builder.WriteString(base.tag())
+	}
+
+	writeText := func(text string) {
+		builder.WriteString(tview.Escape(controlRe.ReplaceAllString(text, "")))
+	}
+
+	last := 0
+	for _, m := range ansiRe.FindAllStringSubmatchIndex(line, -1) {
+		writeText(line[last:m[0]])
+		last = m[1]
+
+		if line[m[4]:m[5]] != "m" {
+			continue
+		}
+		style = applySGR(style, base, line[m[2]:m[3]])
+		builder.WriteString(style.tag())
+	}
+	writeText(line[last:])
+
+	if style != base || fg != "-" {
+		builder.WriteString("[-:-:-]")
+	}
+	return builder.String()
+}
+
+func applySGR(style ansiStyle, base ansiStyle, params string) ansiStyle {
+	codes := strings.Split(params, ";")
+	for idx := 0; idx < len(codes); idx++ {
+		code, err := strconv.Atoi(codes[idx])
+		if err != nil {
+			code = 0
+		}
+
+		switch {
+		case code == 0:
+			style = base
+		case code == 1:
+			style.attrs = addAttr(style.attrs, "b")
+		case code == 2:
+			style.attrs = addAttr(style.attrs, "d")
+		case code == 3:
+			style.attrs = addAttr(style.attrs, "i")
+		case code == 4:
+			style.attrs = addAttr(style.attrs, "u")
+		case code == 5:
+			style.attrs = addAttr(style.attrs, "l")
+		case code == 7:
+			style.attrs = addAttr(style.attrs, "r")
+		case code == 22 || code == 23 || code == 24 || code == 25 || code == 27:
+			style.attrs = ""
+		case code >= 30 && code <= 37:
+			style.fg = ansiColors[code-30]
+		case code >= 90 && code <= 97:
+			style.fg = ansiBright[code-90]
+		case code == 39:
+			style.fg = base.fg
+		case code >= 40 && code <= 47:
+			style.bg = ansiColors[code-40]
+		case code >= 100 && code <= 107:
+			style.bg = ansiBright[code-100]
+		case code == 49:
+			style.bg = base.bg
+		case code == 38 || code == 48:
+			color, consumed := extendedColor(codes[idx+1:])
+			idx += consumed
+			if color == "" {
+				continue
+			}
+			if code == 38 {
+				style.fg = color
+			} else {
+				style.bg = color
+			}
+		}
+	}
+	return style
+}
+
+// extendedColor parses the arguments of a 256 color (5;n) or true color
+// (2;r;g;b) SGR parameter, returning the color and the number of parameters used
+func extendedColor(params []string) (string, int) {
+	if len(params) == 0 {
+		return "", 0
+	}
+
+	values := make([]int, 0, 4)
+	for _, param := range params {
+		value, _ := strconv.Atoi(param)
+		values = append(values, value)
+	}
+
+	switch {
+	case values[0] == 5 && len(values) >= 2 && values[1] >= 0 && values[1] <= 255:
+		return fmt.Sprintf("#%06x", tcell.PaletteColor(values[1]).Hex()), 2
+	case values[0] == 2 && len(values) >= 4:
+		return fmt.Sprintf("#%02x%02x%02x", values[1], values[2], values[3]), 4
+	}
+	return "", len(params)
+}
+
+func addAttr(attrs string, attr string) string {
+	if strings.Contains(attrs, attr) {
+		return attrs
+	}
+	return attrs + attr
+}
@@ -0,0 +1,59 @@
+package ui
+
+import "testing"
+
+func TestTranslateANSI(t *testing.T) {
+	cases := []struct {
+		name     string
+		line     string
+		fg       string
+		expected string
+	}{
+		{name: "plain", line: "hello", fg: "-", expected: "hello"},
+		{name: "plain_colored", line: "hello", fg: "red", expected: "[red:-:-]hello[-:-:-]"},
+		{name: "reset", line: "\x1b[31mERROR:\x1b[0m boom", fg: "-", expected: "[maroon:-:-]ERROR:[-:-:-] boom"},
+		{name: "bold_bright", line: "\x1b[1;94mtitle", fg: "-", expected: "[blue:-:b]title[-:-:-]"},
+		{name: "default_foreground", line: "\x1b[32mok\x1b[39m!", fg: "yellow", expected: "[yellow:-:-][green:-:-]ok[yellow:-:-]![-:-:-]"},
+		{name: "escaped_tags", line: "[download] 50%", fg: "-", expected: "[download[] 50%"},
+		{name: "other_sequences", line: "\x1b[2Kdone", fg: "-", expected: "done"},
+		{name: "control_characters", line: "a\x07b", fg: "-", expected: "ab"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := translateANSI(c.line, c.fg); got != c.expected {
+				t.Errorf("Expected %q, got %q", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestApplySGR(t *testing.T) {
+	base := ansiStyle{fg: "white", bg: "-"}
+
+	cases := []struct {
+		name     string
+		style    ansiStyle
+		params   string
+		expected ansiStyle
+	}{
+		{name: "reset", style: ansiStyle{fg: "red", bg: "blue", attrs: "b"}, params: "0", expected: base},
+		{name: "empty_resets", style: ansiStyle{fg: "red", bg: "-"}, params: "", expected: base},
+		{name: "foreground", style: base, params: "33", expected: ansiStyle{fg: "olive", bg: "-"}},
+		{name: "bright_background", style: base, params: "101", expected: ansiStyle{fg: "white", bg: "red"}},
+		{name: "attributes", style: base, params: "1;4;1", expected: ansiStyle{fg: "white", bg: "-", attrs: "bu"}},
+		{name: "attributes_off", style: ansiStyle{fg: "white", bg: "-", attrs: "bu"}, params: "22", expected: base},
+		{name: "default_colors", style: ansiStyle{fg: "red", bg: "blue"}, params: "39;49", expected: base},
+		{name: "palette", style: base, params: "38;5;196", expected: ansiStyle{fg: "#ff0000", bg: "-"}},
+		{name: "true_color", style: base, params: "48;2;1;2;3;1", expected: ansiStyle{fg: "white", bg: "#010203", attrs: "b"}},
+		{name: "invalid_extended", style: base, params: "38;9", expected: base},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := applySGR(c.style, base, c.params); got != c.expected {
+				t.Errorf("Expected %+v, got %+v", c.expected, got)
+			}
+		})
+	}
+}
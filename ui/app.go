@@ -1,10 +1,18 @@
 package ui
 
 import (
+	"context"
 	"fmt"
-	"sort"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/api"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/clipboard"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/storage"
 	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -18,21 +26,94 @@ type ViewController interface {
 	SetupEvents()
 }
 
+// Downloads are the items listed by the interface, run by a local queue or
+// by a daemon the interface is attached to
+type Downloads interface {
+	Items() []*url.UrlItem
+	Get(id string) *url.UrlItem
+	Find(rawUrl string) *url.UrlItem
+	Events() *url.Bus
+	BatchItems(entries []url.BatchEntry, cfg config.Config, profile config.Profile, executor url.CommandExecutor) ([]*url.UrlItem, []error)
+	Add(items ...*url.UrlItem)
+	Remove(item *url.UrlItem)
+	RemoveCompleted()
+	SortByComplete()
+	Move(item *url.UrlItem, delta int)
+	Pause(item *url.UrlItem) bool
+	Resume(item *url.UrlItem) bool
+	SetFormat(item *url.UrlItem, choice url.FormatChoice)
+	Logs(item *url.UrlItem) *url.LogBuffer
+	Concurrency() int
+	SetConcurrency(n int)
+}
+
 type App struct {
 	*tview.Application
 	pages       *tview.Pages
 	views       map[string]ViewController
 	currentView string
-	urls        []*url.UrlItem
+	queue       Downloads
+	// local is the queue running the downloads, nil when attached to a daemon
+	local *url.Queue
+	// store saves the local queue, nil when attached to a daemon
+	store  storage.Storage
+	config config.Config
+	// stopClipboard stops the clipboard watcher, nil when not watching
+	stopClipboard chan struct{}
+	// apiServer serves the HTTP API, nil when disabled
+	apiServer *http.Server
+	// stopSaving stops saving the local queue as it changes, nil when
+	// attached to a daemon
+	stopSaving func()
+}
+
+// NewApp runs the downloads in the application, they stop when it exits
+func NewApp(cfg config.Config, store storage.Storage) *App {
+	queue := url.NewQueue(cfg.Concurrency)
+	queue.ApplyConfig(cfg)
+
+	app := newApp(cfg, queue)
+	app.local = queue
+	app.store = store
+
+	ctx, cancel := context.WithCancel(context.Background())
+	saving := make(chan struct{})
+	go func() {
+		storage.SaveOnChange(ctx, queue, store)
+		close(saving)
+	}()
+	app.stopSaving = func() {
+		cancel()
+		<-saving
+	}
+
+	if cfg.API.Enabled {
+		apiServer := api.NewServer(queue, cfg, &url.RealCommandExecutor{})
+		server, err := apiServer.Listen(cfg.API.Listen)
+		if err != nil {
+			apiServer.Close()
+			log.Printf("could not start the api: %v", err)
+		}
+		app.apiServer = server
+	}
+
+	return app
 }
 
-func NewApp() *App {
+// NewClientApp shows the downloads of a daemon, which carries on running them
+// once the application exits
+func NewClientApp(cfg config.Config, downloads Downloads) *App {
+	return newApp(cfg, downloads)
+}
+
+func newApp(cfg config.Config, downloads Downloads) *App {
 	app := &App{
 		Application: tview.NewApplication(),
 		pages:       tview.NewPages(),
 		views:       make(map[string]ViewController),
 		currentView: "MainView",
-		urls:        []*url.UrlItem{},
+		queue:       downloads,
+		config:      cfg,
 	}
 
 	setupViews := []struct {
@@ -46,6 +127,8 @@ func NewApp() *App {
 		{viewController: NewUrlFormView(app), resize: true, visible: false, setupEvents: false},
 		{viewController: NewConfirmQuitView(app), resize: false, visible: false, setupEvents: true},
 		{viewController: NewSearchView(app), resize: true, visible: false, setupEvents: true},
+		{viewController: NewFormatView(app), resize: true, visible: false, setupEvents: true},
+		{viewController: NewPlaylistView(app), resize: true, visible: false, setupEvents: true},
 	}
 
 	for _, sv := range setupViews {
@@ -55,12 +138,13 @@ func NewApp() *App {
 		}
 	}
 
-	go func() {
-		for {
-			app.Draw()
-			time.Sleep(200 * time.Millisecond)
+	if cfg.SimulateOnAdd {
+		app.views["UrlFormView"].(*UrlFormView).simulate = func(rawUrl string) error {
+			return url.Simulate(&url.RealCommandExecutor{}, cfg.Binary, rawUrl)
 		}
-	}()
+	}
+	go app.watchEvents()
+	app.watchClipboard()
 
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyCtrlC {
@@ -97,121 +181,589 @@ func (a *App) DisplayPage(page string) {
 
 func (a *App) AddItem() {
 	item := url.NewUrlItem("")
+	if len(a.config.Profiles) > 0 {
+		item.Profile = a.config.Profiles[0]
+	}
 	urlFormView := a.views["UrlFormView"].(*UrlFormView)
 
-	okAction := func() {
-		item.Start()
-		a.urls = append(a.urls, item)
-		a.RedrawList()
+	applyConfig := func() {
+		if err := item.ApplyConfig(a.config, item.Profile); err != nil {
+			log.Println(err)
+		}
+	}
+	cancelAction := func() {
+		a.SwitchToPage("MainView")
+	}
+	addAction := func(items ...*url.UrlItem) {
+		a.background(func() { a.queue.Add(items...) }, a.RedrawList)
 		a.SwitchToPage("MainView")
 	}
+	// warnedUrl is the duplicate url the user was warned about, saving it
+	// again adds it anyway
+	var warnedUrl string
+	okAction := func() {
+		// the url typed is downloaded, its normalized form only detects duplicates
+		cleaned, err := url.Clean(item.Url)
+		if err != nil {
+			urlFormView.setMessage("[red]" + tview.Escape(err.Error()))
+			return
+		}
+		item.Url = cleaned
+
+		if duplicate := a.queue.Find(item.Url); duplicate != nil && warnedUrl != item.Url {
+			warnedUrl = item.Url
+			urlFormView.setMessage(fmt.Sprintf(
+				"[yellow]Already in the list as %s (%s), save again to add it anyway",
+				tview.Escape(duplicate.Title()), duplicate.Stage(),
+			))
+			return
+		}
+
+		applyConfig()
+		if !url.LooksLikePlaylist(item.Url) {
+			addAction(item)
+			return
+		}
+		a.views["PlaylistView"].(*PlaylistView).expand(item, addAction, cancelAction)
+		a.SwitchToPage("PlaylistView")
+	}
+	formatAction := func() {
+		applyConfig()
+		a.views["FormatView"].(*FormatView).pickFormat(item, okAction, cancelAction)
+		a.SwitchToPage("FormatView")
+	}
+	urlFormView.contructForm(item, a.config.Profiles, okAction, formatAction, a.AddItems, cancelAction)
+
+	a.SwitchToPage("UrlFormView")
+}
+
+// AddItems opens the add form in bulk mode, every url pasted or imported in
+// it is queued as a single download
+func (a *App) AddItems() {
+	urlFormView := a.views["UrlFormView"].(*UrlFormView)
+
+	addAction := func(text string, profile config.Profile) {
+		entries, err := url.ParseBatch(strings.NewReader(text))
+		if err != nil {
+			urlFormView.setMessage("[red]" + tview.Escape(err.Error()))
+			return
+		}
+
+		added, errs := a.AddBatch(entries, profile)
+		if len(errs) == 0 {
+			a.SwitchToPage("MainView")
+			return
+		}
+
+		// the form stays open listing the entries which were skipped
+		skipped := make([]string, 0, len(errs))
+		for _, err := range errs {
+			skipped = append(skipped, err.Error())
+		}
+		urlFormView.setMessage(fmt.Sprintf(
+			"[blue]%d added [yellow]%d skipped, %s",
+			added, len(errs), tview.Escape(strings.Join(skipped, ", ")),
+		))
+	}
 	cancelAction := func() {
 		a.SwitchToPage("MainView")
 	}
-	urlFormView.contructForm(item, okAction, cancelAction)
+	urlFormView.contructBulkForm(a.config.Profiles, addAction, cancelAction)
 
 	a.SwitchToPage("UrlFormView")
 }
 
-func (a *App) ItemStatusUpdater(item *url.UrlItem, itemIdx int) {
-	mainView := a.views["MainView"].(*MainView)
+// AddBatch queues the urls of entries with profile, the entries which are
+// invalid or already listed are skipped and returned as errors
+func (a *App) AddBatch(entries []url.BatchEntry, profile config.Profile) (int, []error) {
+	if profile.Name == "" && len(a.config.Profiles) > 0 {
+		profile = a.config.Profiles[0]
+	}
 
-	go func() {
-		defer mainView.wg.Done()
-
-		ticker := time.NewTicker(10 * time.Millisecond)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-mainView.stopCh:
-				return
-			case <-ticker.C:
-				var recordStatus string
-				switch item.Recording {
-				case url.StageNotStarted:
-					recordStatus = "blue"
-				case url.StageDownloading:
-					recordStatus = "green"
-				case url.StageCompleted:
-					recordStatus = "darkcyan"
-				case url.StageProcessing:
-					recordStatus = "magenta"
-				case url.StageError:
-					recordStatus = "red"
-				}
+	items, errs := a.queue.BatchItems(entries, a.config, profile, &url.RealCommandExecutor{})
+	if len(items) > 0 {
+		a.background(func() { a.queue.Add(items...) }, a.RedrawList)
+	}
+	return len(items), errs
+}
 
-				var recordingTime string
-				if item.StoppedAt.IsZero() {
-					recordingTime = fmt.Sprintf("%v", time.Since(item.StartedAt).Round(time.Second))
-				} else {
-					recordingTime = fmt.Sprintf("%v", item.StoppedAt.Sub(item.StartedAt).Round(time.Second))
-				}
+// PickFormat opens the format picker for the selected item, the choice is
+// used the next time it starts
+func (a *App) PickFormat() {
+	item := a.CurrentItem()
+	if item == nil || item.Stage().Running() {
+		return
+	}
+
+	done := func() {
+		choice := item.Format()
+		a.background(func() { a.queue.SetFormat(item, choice) }, nil)
+		a.RenderItem(item)
+		a.SaveState()
+		a.SwitchToPage("MainView")
+	}
+	a.views["FormatView"].(*FormatView).pickFormat(item, done, func() {
+		a.SwitchToPage("MainView")
+	})
+	a.SwitchToPage("FormatView")
+}
+
+// watchClipboard starts picking up the urls copied to the clipboard when
+// enabled in the config
+func (a *App) watchClipboard() {
+	if !a.config.Clipboard.Enabled {
+		return
+	}
+
+	source, err := clipboard.NewSource(a.config.Clipboard.Command)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	watcher := clipboard.NewWatcher(source, a.config.Clipboard.Hosts)
+	a.stopClipboard = make(chan struct{})
+	go watcher.Run(time.Duration(a.config.Clipboard.Interval), a.stopClipboard, func(urls []string) {
+		a.QueueUpdateDraw(func() {
+			a.clipboardUrls(urls)
+		})
+	})
+}
+
+// clipboardUrls adds the copied urls not in the list yet, or asks about them
+// in the main view unless auto_add is set
+func (a *App) clipboardUrls(urls []string) {
+	urls = slices.DeleteFunc(urls, func(rawUrl string) bool {
+		return a.queue.Find(rawUrl) != nil
+	})
+	if len(urls) == 0 {
+		return
+	}
+
+	if !a.config.Clipboard.AutoAdd {
+		a.views["MainView"].(*MainView).askToAdd(urls)
+		return
+	}
+
+	entries := make([]url.BatchEntry, 0, len(urls))
+	for idx, rawUrl := range urls {
+		entries = append(entries, url.BatchEntry{Line: idx + 1, Url: rawUrl})
+	}
+	a.AddBatch(entries, config.Profile{})
+}
 
-				mainView.urlsList.SetItemText(
-					itemIdx,
-					fmt.Sprintf("%-50s [blue]([%s]%s[blue]) ([grey]%s[blue])", item.Url, recordStatus, item.Recording, recordingTime),
-					"",
-				)
+// redrawDelay coalesces bursts of events, such as progress updates from
+// several downloads, into a single redraw
+const redrawDelay = 100 * time.Millisecond
+
+// watchEvents redraws the rows of the items reported by the queue events
+func (a *App) watchEvents() {
+	events, _ := a.queue.Events().Subscribe(
+		url.EventAdded, url.EventStarted, url.EventProgress, url.EventStageChanged,
+		url.EventFinished, url.EventFailed, url.EventRemoved, url.EventMetadata,
+	)
+
+	dirty := make(map[string]struct{})
+	relist, pending := false, false
+	timer := time.NewTimer(redrawDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			if event.Type == url.EventAdded || event.Type == url.EventRemoved {
+				relist = true
+			}
+			dirty[event.Item.ID()] = struct{}{}
+			if !pending {
+				pending = true
+				timer.Reset(redrawDelay)
 			}
+		case <-timer.C:
+			items, redrawList := dirty, relist
+			dirty = make(map[string]struct{})
+			relist, pending = false, false
+
+			a.QueueUpdateDraw(func() {
+				if redrawList {
+					a.RedrawList()
+					return
+				}
+				for id := range items {
+					if item := a.queue.Get(id); item != nil {
+						a.RenderItem(item)
+					}
+				}
+			})
 		}
-	}()
+	}
 }
 
-func (a *App) RedrawList() {
+// RenderItem updates the row of the item in the main list
+func (a *App) RenderItem(item *url.UrlItem) {
 	mainView := a.views["MainView"].(*MainView)
 
-	close(mainView.stopCh)
-	mainView.wg.Wait()
+	if item.Group.Url != "" {
+		a.renderGroup(item.Group)
+	}
+
+	itemIdx := mainView.itemRow(item)
+	if itemIdx < 0 {
+		return
+	}
+
+	stage := item.Stage()
+
+	var recordStatus string
+	switch stage {
+	case url.StageNotStarted:
+		recordStatus = "blue"
+	case url.StageQueued:
+		recordStatus = "yellow"
+	case url.StagePaused:
+		recordStatus = "orange"
+	case url.StageDownloading:
+		recordStatus = "green"
+	case url.StageCompleted:
+		recordStatus = "darkcyan"
+	case url.StageProcessing:
+		recordStatus = "magenta"
+	case url.StageError:
+		recordStatus = "red"
+	case url.StageArchived:
+		recordStatus = "grey"
+	}
+
+	var recordingTime string
+	startedAt, stoppedAt := item.StartedAt(), item.StoppedAt()
+	switch {
+	case startedAt.IsZero():
+		recordingTime = "0s"
+	case stoppedAt.IsZero():
+		recordingTime = fmt.Sprintf("%v", time.Since(startedAt).Round(time.Second))
+	default:
+		recordingTime = fmt.Sprintf("%v", stoppedAt.Sub(startedAt).Round(time.Second))
+	}
 
-	mainView.stopCh = make(chan struct{})
-	mainView.wg.Add(len(a.urls))
+	title := tview.Escape(item.Title())
+	if item.Group.Url != "" {
+		title = "  " + title
+	}
+	if metadata := item.Metadata(); metadata != nil && metadata.Duration > 0 {
+		title += fmt.Sprintf(" [grey](%v)[blue]", metadata.Length().Round(time.Second))
+	}
+
+	var details string
+	if failure := item.Failure(); stage == url.StageError && failure != nil {
+		details = fmt.Sprintf(" [red]%s", tview.Escape(failure.String()))
+	} else {
+		details = formatProgress(item.Progress())
+	}
+	if selector := item.Format().Selector(); selector != "" {
+		details += fmt.Sprintf(" [grey]-f %s", tview.Escape(selector))
+	}
+	details += formatRetry(item)
+
+	mainView.urlsList.SetItemText(
+		itemIdx,
+		fmt.Sprintf(
+			"%-50s [blue]([%s]%s[blue]) ([grey]%s[blue])%s",
+			title, recordStatus, stage, recordingTime, details,
+		),
+		"",
+	)
+}
+
+// renderGroup updates the header row of a group with the stages of its items
+func (a *App) renderGroup(group url.Group) {
+	mainView := a.views["MainView"].(*MainView)
+
+	groupIdx := mainView.groupRow(group)
+	if groupIdx < 0 {
+		return
+	}
+
+	counts := make(map[url.DownloadStage]int)
+	items := a.groupItems(group)
+	for _, item := range items {
+		counts[item.Stage()]++
+	}
+
+	marker := "▾"
+	if mainView.collapsed[group.Url] {
+		marker = "▸"
+	}
+
+	text := fmt.Sprintf(
+		"[yellow]%s %s [blue]([darkcyan]%d/%d completed[blue])",
+		marker, tview.Escape(group.Title), counts[url.StageCompleted], len(items),
+	)
+	if running := counts[url.StageDownloading] + counts[url.StageProcessing]; running > 0 {
+		text += fmt.Sprintf(" [green]%d downloading", running)
+	}
+	if counts[url.StagePaused] > 0 {
+		text += fmt.Sprintf(" [orange]%d paused", counts[url.StagePaused])
+	}
+	if counts[url.StageArchived] > 0 {
+		text += fmt.Sprintf(" [grey]%d archived", counts[url.StageArchived])
+	}
+	if counts[url.StageError] > 0 {
+		text += fmt.Sprintf(" [red]%d failed", counts[url.StageError])
+	}
+
+	mainView.urlsList.SetItemText(groupIdx, text, "")
+}
+
+// groupItems returns the items of group in queue order
+func (a *App) groupItems(group url.Group) []*url.UrlItem {
+	return slices.DeleteFunc(a.queue.Items(), func(item *url.UrlItem) bool {
+		return item.Group.Url != group.Url
+	})
+}
+
+func (a *App) RedrawList() {
+	mainView := a.views["MainView"].(*MainView)
+
+	mainView.rows = mainView.buildRows(a.queue.Items())
 
 	curr := mainView.urlsList.GetCurrentItem()
 
 	mainView.urlsList.Clear()
-	for idx, item := range a.urls {
-		mainView.urlsList.AddItem(item.Url, "", 0, nil)
-		a.ItemStatusUpdater(item, idx)
+	for _, row := range mainView.rows {
+		if row.item == nil {
+			mainView.urlsList.AddItem(tview.Escape(row.group.Title), "", 0, nil)
+			continue
+		}
+		mainView.urlsList.AddItem(tview.Escape(row.item.Title()), "", 0, nil)
+	}
+	for _, row := range mainView.rows {
+		if row.item == nil {
+			a.renderGroup(row.group)
+		} else {
+			a.RenderItem(row.item)
+		}
 	}
 
 	mainView.urlsList.SetCurrentItem(curr)
+	mainView.updateTitle()
+
+	a.SaveState()
 }
 
-func (a *App) RemoveItem() {
-	if len(a.urls) == 0 {
+// Restore loads the download list saved by a previous run, a daemon restores
+// its own
+func (a *App) Restore() error {
+	if a.local == nil {
+		a.RedrawList()
+		return nil
+	}
+
+	items, err := storage.LoadItems(a.store, a.config, &url.RealCommandExecutor{})
+	if err != nil {
+		return err
+	}
+	a.local.Restore(items...)
+	a.RedrawList()
+
+	return nil
+}
+
+// SaveState persists the current download list, a daemon saves its own
+func (a *App) SaveState() {
+	if a.store == nil {
 		return
 	}
+	if err := storage.SaveItems(a.store, a.queue.Items()); err != nil {
+		log.Println(err)
+	}
+}
+
+// CurrentItem returns the item selected in the main list, or nil when a
+// group header is selected
+func (a *App) CurrentItem() *url.UrlItem {
+	row, ok := a.currentRow()
+	if !ok {
+		return nil
+	}
+	return row.item
+}
+
+// CurrentItems returns the selected item, or every item of the selected group
+func (a *App) CurrentItems() []*url.UrlItem {
+	row, ok := a.currentRow()
+	switch {
+	case !ok:
+		return nil
+	case row.item == nil:
+		return a.groupItems(row.group)
+	default:
+		return []*url.UrlItem{row.item}
+	}
+}
 
+func (a *App) currentRow() (listRow, bool) {
 	mainView := a.views["MainView"].(*MainView)
 
 	curr := mainView.urlsList.GetCurrentItem()
-	go a.urls[curr].Stop()
-	a.urls = append(a.urls[:curr], a.urls[curr+1:]...)
+	if curr < 0 || curr >= len(mainView.rows) {
+		return listRow{}, false
+	}
+	return mainView.rows[curr], true
+}
 
+// ToggleGroup collapses or expands the selected group
+func (a *App) ToggleGroup() {
+	row, ok := a.currentRow()
+	if !ok || row.item != nil {
+		return
+	}
+
+	mainView := a.views["MainView"].(*MainView)
+	mainView.collapsed[row.group.Url] = !mainView.collapsed[row.group.Url]
 	a.RedrawList()
 }
 
-func (a *App) RemoveCompleted() {
-	newUrls := make([]*url.UrlItem, 0, len(a.urls))
-	for _, item := range a.urls {
-		if item.Recording != url.StageCompleted {
-			newUrls = append(newUrls, item)
-		} else {
-			go item.Stop()
-		}
+func (a *App) RemoveItem() {
+	items := a.CurrentItems()
+	if len(items) == 0 {
+		return
 	}
-	a.urls = newUrls
-	a.RedrawList()
+
+	a.background(func() {
+		for _, item := range items {
+			a.queue.Remove(item)
+		}
+	}, a.RedrawList)
+}
+
+func (a *App) RemoveCompleted() {
+	a.background(a.queue.RemoveCompleted, a.RedrawList)
 }
 
 func (a *App) SortByComplete() {
-	sort.Sort(url.ByComplete(a.urls))
-	a.RedrawList()
+	a.background(a.queue.SortByComplete, a.RedrawList)
+}
+
+// MoveItem shifts the selected queued item by delta positions in the queue
+func (a *App) MoveItem(delta int) {
+	item := a.CurrentItem()
+	if item == nil || item.Stage() != url.StageQueued {
+		return
+	}
+
+	mainView := a.views["MainView"].(*MainView)
+
+	a.background(func() { a.queue.Move(item, delta) }, func() {
+		a.RedrawList()
+		mainView.urlsList.SetCurrentItem(mainView.rowOf(item))
+	})
+}
+
+// PauseItem pauses the selected item or group, keeping partial downloads
+func (a *App) PauseItem() {
+	items := a.CurrentItems()
+	a.background(func() {
+		for _, item := range items {
+			a.queue.Pause(item)
+		}
+	}, nil)
+}
+
+// ResumeItem queues the selected paused item or group again
+func (a *App) ResumeItem() {
+	items := a.CurrentItems()
+	a.background(func() {
+		for _, item := range items {
+			a.queue.Resume(item)
+		}
+	}, nil)
+}
+
+// ChangeConcurrency adjusts how many downloads run at the same time
+func (a *App) ChangeConcurrency(delta int) {
+	mainView := a.views["MainView"].(*MainView)
+
+	n := a.queue.Concurrency() + delta
+	a.background(func() { a.queue.SetConcurrency(n) }, mainView.updateTitle)
 }
 
 func (a *App) CleanUp() {
-	for _, item := range a.urls {
-		item.Stop()
+	if a.stopClipboard != nil {
+		close(a.stopClipboard)
+	}
+	if a.apiServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := a.apiServer.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}
+	if a.local != nil {
+		a.stopSaving()
+		// save before stopping so interrupted downloads are resumed on the next run
+		a.SaveState()
+		a.local.StopAll()
+	}
+}
+
+// Attached tells whether the downloads are run by a daemon
+func (a *App) Attached() bool {
+	return a.local == nil
+}
+
+// background runs action, then done in the event loop when not nil. The
+// daemon may be slow to answer, so when attached action runs in its own
+// goroutine not to freeze the interface, the local queue answers right away.
+func (a *App) background(action func(), done func()) {
+	if !a.Attached() {
+		action()
+		if done != nil {
+			done()
+		}
+		return
+	}
+
+	go func() {
+		action()
+		if done != nil {
+			a.QueueUpdateDraw(done)
+		}
+	}()
+}
+
+func formatProgress(p url.Progress) string {
+	if !p.Known() {
+		return ""
+	}
+
+	const width = 20
+	filled := int(p.Percent / 100 * width)
+	filled = max(0, min(filled, width))
+	bar := strings.Repeat("=", filled) + strings.Repeat("-", width-filled)
+
+	text := fmt.Sprintf(" [green]%s[blue] %5.1f%%", bar, p.Percent)
+	if p.TotalBytes > 0 {
+		text += fmt.Sprintf(" %s/%s", url.FormatBytes(float64(p.DownloadedBytes)), url.FormatBytes(float64(p.TotalBytes)))
+	}
+	if p.Speed > 0 {
+		text += fmt.Sprintf(" %s/s", url.FormatBytes(p.Speed))
+	}
+	if p.ETA > 0 {
+		text += fmt.Sprintf(" ETA %v", p.ETA)
+	}
+	if p.FragmentCount > 0 {
+		text += fmt.Sprintf(" frag %d/%d", p.FragmentIndex, p.FragmentCount)
+	}
+	return text
+}
+
+func formatRetry(item *url.UrlItem) string {
+	var text string
+	if attempts := item.Attempts(); item.Retry.MaxAttempts > 1 && attempts > 1 {
+		text += fmt.Sprintf(" [yellow]attempt %d/%d", attempts, item.Retry.MaxAttempts)
+	}
+	if nextRetryAt := item.NextRetryAt(); !nextRetryAt.IsZero() && item.Stage() == url.StageError {
+		text += fmt.Sprintf(" [yellow]retry at %s", nextRetryAt.Format(time.TimeOnly))
 	}
+	return text
 }
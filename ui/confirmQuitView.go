@@ -31,6 +31,9 @@ func (c *ConfirmQuitView) IsActive() bool {
 
 func (c *ConfirmQuitView) SetActive(status bool) {
 	c.active = status
+	if status && c.App.Attached() {
+		c.root.SetText("Do you want to detach? The daemon keeps downloading.")
+	}
 }
 
 func (c *ConfirmQuitView) Name() string {
@@ -0,0 +1,221 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// FormatView lets the user pick the video and audio format of an item from
+// the formats reported by yt-dlp -J
+type FormatView struct {
+	App          *App
+	name         string
+	root         *tview.Grid
+	title        *tview.TextView
+	video        *tview.Table
+	audio        *tview.Table
+	active       bool
+	item         *url.UrlItem
+	choice       url.FormatChoice
+	videoFormats []url.Format
+	audioFormats []url.Format
+	okAction     func()
+	cancelAction func()
+}
+
+func NewFormatView(app *App) *FormatView {
+	formatView := &FormatView{
+		App:    app,
+		name:   "FormatView",
+		root:   tview.NewGrid(),
+		title:  tview.NewTextView(),
+		video:  tview.NewTable(),
+		audio:  tview.NewTable(),
+		active: false,
+	}
+
+	formatView.title.SetTextAlign(tview.AlignCenter).SetDynamicColors(true)
+
+	formatView.video.SetTitle(" Video ").SetBorder(true)
+	formatView.audio.SetTitle(" Audio ").SetBorder(true)
+	for _, table := range []*tview.Table{formatView.video, formatView.audio} {
+		table.SetSelectable(true, false).SetFixed(1, 0)
+	}
+
+	formatView.root.SetBorder(true)
+	formatView.root.SetRows(1, 0, 0)
+	formatView.root.SetBorderPadding(-1, -1, -1, -1)
+
+	formatView.root.AddItem(formatView.title, 0, 0, 1, 1, 0, 0, false)
+	formatView.root.AddItem(formatView.video, 1, 0, 1, 1, 0, 0, true)
+	formatView.root.AddItem(formatView.audio, 2, 0, 1, 1, 0, 0, false)
+
+	return formatView
+}
+
+// pickFormat shows the formats of item, fetching them first if needed. The
+// choice is stored on the item before calling okAction.
+func (f *FormatView) pickFormat(item *url.UrlItem, okAction func(), cancelAction func()) {
+	f.item = item
+	f.choice = item.Format()
+	f.okAction = okAction
+	f.cancelAction = cancelAction
+	f.videoFormats, f.audioFormats = nil, nil
+	f.video.Clear()
+	f.audio.Clear()
+
+	if metadata := item.Metadata(); metadata != nil && len(metadata.Formats) > 0 {
+		f.setFormats(metadata)
+		return
+	}
+
+	f.title.SetText("Fetching formats of " + tview.Escape(item.Url) + "...")
+	go func() {
+		err := item.FetchMetadata()
+		f.App.QueueUpdateDraw(func() {
+			if f.item != item {
+				return
+			}
+			if err != nil {
+				f.title.SetText("[red]" + tview.Escape(err.Error()))
+				return
+			}
+			f.setFormats(item.Metadata())
+		})
+	}()
+}
+
+func (f *FormatView) setFormats(metadata *url.Metadata) {
+	f.title.SetText(fmt.Sprintf(
+		"%s [grey](enter: pick, tab: switch table, esc: cancel)",
+		tview.Escape(f.item.Title()),
+	))
+
+	f.videoFormats = metadata.VideoFormats()
+	f.audioFormats = metadata.AudioFormats()
+
+	fillTable(f.video, []string{"ID", "Resolution", "FPS", "Codec", "Ext", "Bitrate", "Size", "Note"},
+		f.videoFormats, f.choice.Video, func(format url.Format) []string {
+			return []string{
+				format.ID,
+				formatResolution(format),
+				formatNumber(format.FPS, ""),
+				format.VCodec,
+				format.Ext,
+				formatNumber(format.TBR, "k"),
+				formatSize(format.Size()),
+				format.Note,
+			}
+		})
+	fillTable(f.audio, []string{"ID", "Codec", "Ext", "Bitrate", "Size", "Note"},
+		f.audioFormats, f.choice.Audio, func(format url.Format) []string {
+			return []string{
+				format.ID,
+				format.ACodec,
+				format.Ext,
+				formatNumber(format.ABR, "k"),
+				formatSize(format.Size()),
+				format.Note,
+			}
+		})
+
+	f.App.SetFocus(f.video)
+}
+
+// fillTable lists the formats after a header and a first row letting yt-dlp
+// choose, selecting the row of the format with id selected
+func fillTable(table *tview.Table, header []string, formats []url.Format, selected string, columns func(url.Format) []string) {
+	for column, name := range header {
+		table.SetCell(0, column, tview.NewTableCell(name).SetSelectable(false).SetTextColor(tcell.ColorYellow))
+	}
+	table.SetCell(1, 0, tview.NewTableCell("default"))
+
+	table.Select(1, 0)
+	for idx, format := range formats {
+		row := idx + 2
+		for column, text := range columns(format) {
+			table.SetCell(row, column, tview.NewTableCell(tview.Escape(text)))
+		}
+		if format.ID == selected {
+			table.Select(row, 0)
+		}
+	}
+	table.ScrollToBeginning()
+}
+
+// formatAt returns the id of the format on a table row, "" for the default row
+func formatAt(formats []url.Format, row int) string {
+	if row < 2 || row-2 >= len(formats) {
+		return ""
+	}
+	return formats[row-2].ID
+}
+
+func formatResolution(format url.Format) string {
+	if format.Width > 0 && format.Height > 0 {
+		return fmt.Sprintf("%dx%d", format.Width, format.Height)
+	}
+	return format.Resolution
+}
+
+func formatNumber(value float64, unit string) string {
+	if value <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.0f%s", value, unit)
+}
+
+func formatSize(size int64) string {
+	if size <= 0 {
+		return ""
+	}
+	return url.FormatBytes(float64(size))
+}
+
+func (f *FormatView) IsActive() bool {
+	return f.active
+}
+
+func (f *FormatView) SetActive(status bool) {
+	f.active = status
+}
+
+func (f *FormatView) Name() string {
+	return f.name
+}
+
+func (f *FormatView) Root() tview.Primitive {
+	return f.root
+}
+
+func (f *FormatView) SetupEvents() {
+	f.video.SetSelectedFunc(func(row int, _ int) {
+		f.choice.Video = formatAt(f.videoFormats, row)
+		f.App.SetFocus(f.audio)
+	})
+
+	f.audio.SetSelectedFunc(func(row int, _ int) {
+		f.choice.Audio = formatAt(f.audioFormats, row)
+		f.item.SetFormat(f.choice)
+		f.okAction()
+	})
+
+	f.root.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyTab:
+			if f.video.HasFocus() {
+				f.App.SetFocus(f.audio)
+			} else {
+				f.App.SetFocus(f.video)
+			}
+			return nil
+		case event.Key() == tcell.KeyEscape, event.Rune() == 'q':
+			f.cancelAction()
+			return nil
+		}
+		return event
+	})
+}
@@ -1,10 +1,8 @@
 package ui
 
 import (
-	"bufio"
-	"bytes"
-	"io"
-	"regexp"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
@@ -12,13 +10,25 @@ import (
 	"github.com/rivo/tview"
 )
 
+// stderrColor is the color of the stderr lines which do not set their own
+const stderrColor = "tomato"
+
 type LogsView struct {
-	App    *App
-	name   string
-	root   *tview.Grid
-	title  *tview.TextView
-	log    *tview.TextView
-	active bool
+	App     *App
+	name    string
+	root    *tview.Grid
+	title   *tview.TextView
+	panes   *tview.Flex
+	stdout  *tview.TextView
+	stderr  *tview.TextView
+	active  bool
+	item    *url.UrlItem
+	lastSeq uint64
+	// loaded tells whether the output of item was fetched, new lines are
+	// only appended after it
+	loaded bool
+	split  bool
+	follow bool
 }
 
 func NewLogsView(app *App) *LogsView {
@@ -27,84 +37,202 @@ func NewLogsView(app *App) *LogsView {
 		name:   "LogsView",
 		root:   tview.NewGrid(),
 		title:  tview.NewTextView(),
-		log:    tview.NewTextView(),
+		panes:  tview.NewFlex(),
+		stdout: tview.NewTextView(),
+		stderr: tview.NewTextView(),
 		active: false,
+		follow: true,
 	}
 
-	logsView.title.SetTextAlign(tview.AlignCenter).SetText("Stdout")
-	logsView.log.SetMaxLines(1000)
+	logsView.title.SetTextAlign(tview.AlignCenter).SetDynamicColors(true)
+	for _, pane := range []*tview.TextView{logsView.stdout, logsView.stderr} {
+		pane.SetDynamicColors(true).SetMaxLines(app.config.LogLines)
+		pane.SetBorder(true)
+	}
 
 	logsView.root.SetBorder(true)
-	logsView.root.SetBorders(true).SetRows(1, 5)
+	logsView.root.SetRows(1, 0)
 	logsView.root.SetBorderPadding(-1, -1, -1, -1)
 
 	logsView.root.AddItem(logsView.title, 0, 0, 1, 1, 0, 0, false)
-	logsView.root.AddItem(logsView.log, 1, 0, 2, 1, 0, 0, true)
+	logsView.root.AddItem(logsView.panes, 1, 0, 1, 1, 0, 0, true)
+
+	logsView.layoutPanes()
+
+	go logsView.watchEvents()
 
 	return logsView
 }
 
+// layoutPanes shows a single interleaved pane, or stdout and stderr side by
+// side in split mode
+func (l *LogsView) layoutPanes() {
+	l.panes.Clear()
+	l.panes.AddItem(l.stdout, 0, 1, true)
+	if l.split {
+		l.stdout.SetTitle(" stdout ")
+		l.stderr.SetTitle(" stderr ")
+		l.panes.AddItem(l.stderr, 0, 1, false)
+	} else {
+		l.stdout.SetTitle(" stdout + stderr ")
+	}
+}
+
+// pane returns the text view showing the lines of stream
+func (l *LogsView) pane(stream url.Stream) *tview.TextView {
+	if l.split && stream == url.StreamStderr {
+		return l.stderr
+	}
+	return l.stdout
+}
+
+func (l *LogsView) updateTitle() {
+	title := "Output"
+	if file := l.item.LogFile(); file != "" {
+		title += " " + tview.Escape(file)
+	}
+
+	mode := "interleaved"
+	if l.split {
+		mode = "split"
+	}
+	follow := "off"
+	if l.follow {
+		follow = "on"
+	}
+
+	l.title.SetText(fmt.Sprintf(
+		"%s [grey](s: %s, f: follow %s, tab: switch pane, q: back)",
+		title, mode, follow,
+	))
+}
+
+// setLogText shows the output of item recorded so far, new lines are
+// appended by watchEvents while the view is active
 func (l *LogsView) setLogText(item *url.UrlItem) {
-	if item.Recording != url.StageDownloading {
-		l.SetLogMessage("yt-dlp is done")
+	l.item = item
+	l.lastSeq = 0
+	l.loaded = false
+	l.stdout.Clear()
+	l.stderr.Clear()
+	l.updateTitle()
+
+	// the lines of a daemon item are fetched the first time
+	var logs *url.LogBuffer
+	l.App.background(func() { logs = l.App.queue.Logs(item) }, func() {
+		if l.item != item || l.loaded {
+			return
+		}
+		l.loaded = true
+		if dropped := logs.Dropped(); dropped > 0 {
+			fmt.Fprintf(l.stdout, "[grey]... %d earlier lines dropped[-]\n", dropped)
+		}
+		l.appendLines()
+
+		if failure := item.Failure(); item.Stage() == url.StageError && failure != nil {
+			l.appendFailure(failure)
+		}
+	})
+}
+
+// appendLines writes the lines recorded since the last call
+func (l *LogsView) appendLines() {
+	// the lines of a daemon item show up in its buffer once fetched
+	for _, line := range l.item.Logs().Since(l.lastSeq) {
+		fg := "-"
+		if line.Stream == url.StreamStderr {
+			fg = stderrColor
+		}
+		fmt.Fprintln(l.pane(line.Stream), translateANSI(line.Text, fg))
+		l.lastSeq = line.Seq
+	}
+	l.scroll()
+}
+
+func (l *LogsView) appendFailure(failure *url.Failure) {
+	fmt.Fprintf(l.pane(url.StreamStderr), "\n[red]%s[-]\n", tview.Escape(formatFailure(failure)))
+	l.scroll()
+}
+
+// scroll keeps the end of the output visible in follow mode
+func (l *LogsView) scroll() {
+	if !l.follow {
 		return
 	}
+	l.stdout.ScrollToEnd()
+	l.stderr.ScrollToEnd()
+}
 
-	item.Logging = true
-	buffer1 := bytes.Buffer{}
-	buffer2 := bytes.Buffer{}
-	donePipeInLog := make(chan bool, 1)
-	donePipeErrLog := make(chan bool, 1)
-
-	readFromPipe := func(done <-chan bool, data chan []byte, writer io.Writer) {
-		ticker := time.NewTicker(10 * time.Millisecond)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-done:
-				return
-			case d := <-data:
-				r := bytes.NewReader(d)
-				scanner := bufio.NewScanner(r)
-				for scanner.Scan() {
-					ansiRe := regexp.MustCompile(`\x1b[^m]*m`)
-					controlRe := regexp.MustCompile(`[\x00-\x1f\x7f]`)
-					line := scanner.Text()
-					line = ansiRe.ReplaceAllString(line, "")
-					line = controlRe.ReplaceAllString(line, "")
-					line = line + "\n"
-					_, err := writer.Write([]byte(line))
-					if err != nil {
-						return
-					}
-				}
-			case <-ticker.C:
-				continue
-			}
+// toggleFollow switches between following the output and freely scrolling it
+func (l *LogsView) toggleFollow() {
+	l.follow = !l.follow
+	if l.follow {
+		l.scroll()
+	} else {
+		// scrolling to the current offset stops the text views tracking the end
+		for _, pane := range []*tview.TextView{l.stdout, l.stderr} {
+			row, column := pane.GetScrollOffset()
+			pane.ScrollTo(row, column)
 		}
 	}
-	go readFromPipe(donePipeInLog, item.StdoutBuf, &buffer1)
-	go readFromPipe(donePipeErrLog, item.StderrBuf, &buffer2)
-
-	go func() {
-		for {
-			if item.Recording != url.StageDownloading || !l.active {
-				close(donePipeInLog)
-				close(donePipeErrLog)
-				item.Logging = false
-				l.SetLogMessage("yt-dlp is done")
-				return
+	l.updateTitle()
+}
+
+// toggleSplit switches between interleaved and split panes, rendering the
+// output again
+func (l *LogsView) toggleSplit() {
+	l.split = !l.split
+	l.layoutPanes()
+	l.setLogText(l.item)
+	l.App.SetFocus(l.stdout)
+}
+
+// watchEvents follows the output of the item shown while the view is active
+func (l *LogsView) watchEvents() {
+	events, _ := l.App.queue.Events().Subscribe(url.EventLogLine, url.EventFinished, url.EventFailed)
+
+	failures := make(map[string]*url.Failure)
+	pending := false
+	timer := time.NewTimer(redrawDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			if event.Type == url.EventFailed {
+				failures[event.Item.ID()] = event.Failure
+			}
+			if !pending {
+				pending = true
+				timer.Reset(redrawDelay)
 			}
-			log := buffer1.String() + buffer2.String()
-			l.log.SetText(log)
-			time.Sleep(200 * time.Millisecond)
+		case <-timer.C:
+			failed := failures
+			failures = make(map[string]*url.Failure)
+			pending = false
+
+			l.App.QueueUpdateDraw(func() {
+				if !l.active || l.item == nil || !l.loaded {
+					return
+				}
+				l.appendLines()
+				if failure, ok := failed[l.item.ID()]; ok {
+					l.appendFailure(failure)
+				}
+			})
 		}
-	}()
+	}
 }
 
-func (l *LogsView) SetLogMessage(msg string) {
-	l.log.Clear()
-	l.log.SetText(msg)
+func formatFailure(failure *url.Failure) string {
+	msg := fmt.Sprintf("yt-dlp %s", failure)
+	if failure.Err != "" && failure.Kind != url.FailureStart {
+		msg += fmt.Sprintf(" (%s)", failure.Err)
+	}
+	if len(failure.Stderr) > 0 {
+		msg += "\n\nLast stderr lines:\n" + strings.Join(failure.Stderr, "\n")
+	}
+	return msg
 }
 
 func (l *LogsView) IsActive() bool {
@@ -125,8 +253,26 @@ func (l *LogsView) Root() tview.Primitive {
 
 func (l *LogsView) SetupEvents() {
 	l.root.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Rune() == 'q' {
+		if event.Key() == tcell.KeyTab {
+			if l.split && l.stdout.HasFocus() {
+				l.App.SetFocus(l.stderr)
+			} else {
+				l.App.SetFocus(l.stdout)
+			}
+			return nil
+		}
+
+		switch event.Rune() {
+		case 'q':
 			l.App.SwitchToPage("MainView")
+		case 'f':
+			l.toggleFollow()
+			return nil
+		case 's':
+			if l.item != nil {
+				l.toggleSplit()
+			}
+			return nil
 		}
 		return event
 	})
@@ -1,8 +1,11 @@
 package ui
 
 import (
-	"sync"
+	"fmt"
+	"slices"
 
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
@@ -13,32 +16,144 @@ type MainView struct {
 	root     *tview.Flex
 	grid     *tview.Grid
 	urlsList *tview.List
-	active   bool
-	wg       sync.WaitGroup
-	stopCh   chan struct{}
+	rows     []listRow
+	// collapsed holds the urls of the groups whose items are hidden
+	collapsed map[string]bool
+	// prompt asks whether to add the urls copied to the clipboard, pending
+	prompt  *tview.TextView
+	pending []string
+	active  bool
+}
+
+// listRow is a line of the main list, either an item or the header of the
+// group of items expanded from a playlist
+type listRow struct {
+	item  *url.UrlItem
+	group url.Group
 }
 
 func NewMainView(app *App) *MainView {
 	mainView := &MainView{
-		App:      app,
-		name:     "MainView",
-		root:     tview.NewFlex(),
-		grid:     tview.NewGrid(),
-		urlsList: tview.NewList(),
-		active:   true,
-		stopCh:   make(chan struct{}),
+		App:       app,
+		name:      "MainView",
+		root:      tview.NewFlex(),
+		grid:      tview.NewGrid(),
+		urlsList:  tview.NewList(),
+		collapsed: make(map[string]bool),
+		prompt:    tview.NewTextView(),
+		active:    true,
 	}
 
 	mainView.urlsList.ShowSecondaryText(false)
 	mainView.urlsList.SetHighlightFullLine(true)
 	mainView.urlsList.SetMainTextColor(tcell.ColorBlue)
 	mainView.grid.SetBorder(true)
+	mainView.updateTitle()
 	mainView.grid.AddItem(mainView.urlsList, 0, 0, 1, 1, 0, 0, true)
-	mainView.root.SetDirection(tview.FlexRow).AddItem(mainView.grid, 0, 1, true)
+	mainView.prompt.SetDynamicColors(true)
+	mainView.root.SetDirection(tview.FlexRow).
+		AddItem(mainView.grid, 0, 1, true).
+		AddItem(mainView.prompt, 0, 0, false)
 
 	return mainView
 }
 
+func (m *MainView) updateTitle() {
+	m.grid.SetTitle(fmt.Sprintf(" Downloads (parallel: %d) ", m.App.queue.Concurrency()))
+}
+
+// buildRows lays out the items in queue order, the items of a group are listed
+// under its header at the position of its first item unless it is collapsed
+func (m *MainView) buildRows(items []*url.UrlItem) []listRow {
+	members := make(map[string][]*url.UrlItem)
+	for _, item := range items {
+		if item.Group.Url != "" {
+			members[item.Group.Url] = append(members[item.Group.Url], item)
+		}
+	}
+
+	rows := make([]listRow, 0, len(items))
+	listed := make(map[string]bool)
+	for _, item := range items {
+		group := item.Group
+		if group.Url == "" {
+			rows = append(rows, listRow{item: item})
+			continue
+		}
+		if listed[group.Url] {
+			continue
+		}
+
+		listed[group.Url] = true
+		rows = append(rows, listRow{group: group})
+		if m.collapsed[group.Url] {
+			continue
+		}
+		for _, member := range members[group.Url] {
+			rows = append(rows, listRow{item: member})
+		}
+	}
+	return rows
+}
+
+// itemRow returns the index of the row of item, or -1 if it is not listed
+func (m *MainView) itemRow(item *url.UrlItem) int {
+	return slices.IndexFunc(m.rows, func(row listRow) bool {
+		return row.item != nil && row.item.ID() == item.ID()
+	})
+}
+
+// groupRow returns the index of the header of group, or -1
+func (m *MainView) groupRow(group url.Group) int {
+	return slices.IndexFunc(m.rows, func(row listRow) bool {
+		return row.item == nil && row.group.Url == group.Url
+	})
+}
+
+// rowOf returns the row showing item, the header of its group when collapsed
+func (m *MainView) rowOf(item *url.UrlItem) int {
+	if idx := m.itemRow(item); idx >= 0 || item.Group.Url == "" {
+		return idx
+	}
+	return m.groupRow(item.Group)
+}
+
+// askToAdd queues urls copied to the clipboard behind the prompt, the ones
+// already pending are not asked again
+func (m *MainView) askToAdd(urls []string) {
+	for _, rawUrl := range urls {
+		if !slices.Contains(m.pending, rawUrl) {
+			m.pending = append(m.pending, rawUrl)
+		}
+	}
+	m.updatePrompt()
+}
+
+// answerPrompt adds the first pending url when accepted and asks about the next
+func (m *MainView) answerPrompt(accept bool) {
+	rawUrl := m.pending[0]
+	m.pending = m.pending[1:]
+	if accept {
+		m.App.AddBatch([]url.BatchEntry{{Line: 1, Url: rawUrl}}, config.Profile{})
+	}
+	m.updatePrompt()
+}
+
+func (m *MainView) updatePrompt() {
+	if len(m.pending) == 0 {
+		m.prompt.SetText("")
+		m.root.ResizeItem(m.prompt, 0, 0)
+		return
+	}
+
+	text := fmt.Sprintf("[yellow]Add copied url %s?", tview.Escape(m.pending[0]))
+	if more := len(m.pending) - 1; more > 0 {
+		text += fmt.Sprintf(" [grey](%d more)", more)
+	}
+	m.prompt.SetText(text + " [blue](y: add, n: ignore)")
+	m.root.ResizeItem(m.prompt, 1, 0)
+}
+
 func (m *MainView) IsActive() bool {
 	return m.active
 }
@@ -57,16 +172,36 @@ func (m *MainView) Root() tview.Primitive {
 
 func (m *MainView) SetupEvents() {
 	m.root.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Rune() == 'q' {
+		if event.Rune() == 'y' && len(m.pending) > 0 {
+			m.answerPrompt(true)
+		} else if event.Rune() == 'n' && len(m.pending) > 0 {
+			m.answerPrompt(false)
+		} else if event.Rune() == 'q' {
 			m.App.SwitchToPage("ConfirmQuitView")
 		} else if event.Rune() == 'a' {
 			m.App.AddItem()
+		} else if event.Rune() == 'A' {
+			m.App.AddItems()
 		} else if event.Rune() == 'd' {
 			m.App.RemoveItem()
 		} else if event.Rune() == 'f' {
 			m.App.SortByComplete()
+		} else if event.Rune() == 'F' {
+			m.App.PickFormat()
 		} else if event.Rune() == 'C' {
 			m.App.RemoveCompleted()
+		} else if event.Rune() == '+' {
+			m.App.ChangeConcurrency(1)
+		} else if event.Rune() == '-' {
+			m.App.ChangeConcurrency(-1)
+		} else if event.Rune() == 'K' {
+			m.App.MoveItem(-1)
+		} else if event.Rune() == 'J' {
+			m.App.MoveItem(1)
+		} else if event.Rune() == 'p' {
+			m.App.PauseItem()
+		} else if event.Rune() == 'r' {
+			m.App.ResumeItem()
 		} else if event.Rune() == 'j' {
 			return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
 		} else if event.Rune() == 'k' {
@@ -74,21 +209,18 @@ func (m *MainView) SetupEvents() {
 		} else if event.Rune() == '/' {
 			searchView := m.App.views["SearchView"].(*SearchView)
 			searchView.input.SetText("")
-			searchView.results.Clear()
-
-			for _, item := range m.App.urls {
-				searchView.results.AddItem(item.Url, "", 0, nil)
-			}
+			searchView.setResults(m.App.queue.Items())
 
 			m.App.DisplayPage("SearchView")
 		} else if event.Key() == tcell.KeyEnter {
-			if m.urlsList.GetItemCount() == 0 {
+			item := m.App.CurrentItem()
+			if item == nil {
+				m.App.ToggleGroup()
 				return event
 			}
-			index := m.urlsList.GetCurrentItem()
 
 			logsView := m.App.views["LogsView"].(*LogsView)
-			logsView.setLogText(m.App.urls[index])
+			logsView.setLogText(item)
 			m.App.SwitchToPage("LogsView")
 		}
 		return event
@@ -0,0 +1,237 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// PlaylistView lists the entries of a playlist or channel so the ones not
+// wanted can be deselected before they are queued
+type PlaylistView struct {
+	App          *App
+	name         string
+	root         *tview.Grid
+	title        *tview.TextView
+	entries      *tview.List
+	active       bool
+	item         *url.UrlItem
+	playlist     *url.Playlist
+	selected     []bool
+	listed       []bool
+	failed       bool
+	addAction    func(items ...*url.UrlItem)
+	cancelAction func()
+}
+
+func NewPlaylistView(app *App) *PlaylistView {
+	playlistView := &PlaylistView{
+		App:     app,
+		name:    "PlaylistView",
+		root:    tview.NewGrid(),
+		title:   tview.NewTextView(),
+		entries: tview.NewList(),
+		active:  false,
+	}
+
+	playlistView.title.SetTextAlign(tview.AlignCenter).SetDynamicColors(true)
+
+	playlistView.entries.ShowSecondaryText(false)
+	playlistView.entries.SetHighlightFullLine(true)
+	playlistView.entries.SetMainTextColor(tcell.ColorBlue)
+
+	playlistView.root.SetBorder(true)
+	playlistView.root.SetBorders(true).SetRows(1, 0)
+	playlistView.root.SetBorderPadding(-1, -1, -1, -1)
+
+	playlistView.root.AddItem(playlistView.title, 0, 0, 1, 1, 0, 0, false)
+	playlistView.root.AddItem(playlistView.entries, 1, 0, 1, 1, 0, 0, true)
+
+	return playlistView
+}
+
+// expand lists the entries of the playlist at the url of item. The selected
+// entries are passed to addAction as items grouped under the playlist, item
+// itself is added when its url turns out not to be a playlist.
+func (p *PlaylistView) expand(item *url.UrlItem, addAction func(items ...*url.UrlItem), cancelAction func()) {
+	p.item = item
+	p.playlist = nil
+	p.selected = nil
+	p.failed = false
+	p.addAction = addAction
+	p.cancelAction = cancelAction
+	p.entries.Clear()
+
+	p.title.SetText("Listing " + tview.Escape(item.Url) + "...")
+	go func() {
+		playlist, err := item.FetchPlaylist()
+		p.App.QueueUpdateDraw(func() {
+			if p.item != item {
+				return
+			}
+			switch {
+			case errors.Is(err, url.ErrNotPlaylist):
+				p.addAction(item)
+			case err != nil:
+				p.failed = true
+				p.title.SetText(fmt.Sprintf(
+					"[red]%s [grey](c: add as a single download, esc: cancel)",
+					tview.Escape(err.Error()),
+				))
+			default:
+				p.setPlaylist(playlist)
+			}
+		})
+	}()
+}
+
+func (p *PlaylistView) setPlaylist(playlist *url.Playlist) {
+	p.playlist = playlist
+	p.selected = make([]bool, len(playlist.Entries))
+	p.listed = make([]bool, len(playlist.Entries))
+	for idx, entry := range playlist.Entries {
+		// entries already in the list are not selected by default
+		p.listed[idx] = p.App.queue.Find(entry.Link()) != nil
+		p.selected[idx] = !p.listed[idx]
+	}
+
+	p.entries.Clear()
+	for idx := range playlist.Entries {
+		p.entries.AddItem("", "", 0, nil)
+		p.renderEntry(idx)
+	}
+	p.updateTitle()
+}
+
+func (p *PlaylistView) renderEntry(idx int) {
+	entry := p.playlist.Entries[idx]
+
+	check := "[ ]"
+	if p.selected[idx] {
+		check = "[x]"
+	}
+
+	title := entry.Title
+	if title == "" {
+		title = entry.Link()
+	}
+	text := fmt.Sprintf("%s %s", tview.Escape(check), tview.Escape(title))
+	if entry.Duration > 0 {
+		text += fmt.Sprintf(" [grey](%v)", time.Duration(entry.Duration*float64(time.Second)).Round(time.Second))
+	}
+	if p.listed[idx] {
+		text += " [yellow](already in the list)"
+	}
+
+	p.entries.SetItemText(idx, text, "")
+}
+
+func (p *PlaylistView) updateTitle() {
+	count := 0
+	for _, selected := range p.selected {
+		if selected {
+			count++
+		}
+	}
+
+	p.title.SetText(fmt.Sprintf(
+		"%s [blue](%d/%d selected) [grey](space: toggle, a: toggle all, c: queue selected, esc: cancel)",
+		tview.Escape(p.playlist.Title), count, len(p.selected),
+	))
+}
+
+func (p *PlaylistView) toggle(idx int) {
+	if idx < 0 || idx >= len(p.selected) {
+		return
+	}
+	p.selected[idx] = !p.selected[idx]
+	p.renderEntry(idx)
+	p.updateTitle()
+}
+
+func (p *PlaylistView) toggleAll() {
+	all := true
+	for _, selected := range p.selected {
+		all = all && selected
+	}
+	for idx := range p.selected {
+		p.selected[idx] = !all
+		p.renderEntry(idx)
+	}
+	p.updateTitle()
+}
+
+// confirm adds the selected entries, or the url as a single download when it
+// could not be listed
+func (p *PlaylistView) confirm() {
+	if p.item == nil {
+		return
+	}
+	if p.playlist == nil {
+		if p.failed {
+			p.addAction(p.item)
+		}
+		return
+	}
+
+	var entries []url.PlaylistEntry
+	for idx, entry := range p.playlist.Entries {
+		if p.selected[idx] {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return
+	}
+	p.addAction(p.item.Expand(p.playlist, entries)...)
+}
+
+func (p *PlaylistView) IsActive() bool {
+	return p.active
+}
+
+func (p *PlaylistView) SetActive(status bool) {
+	p.active = status
+}
+
+func (p *PlaylistView) Name() string {
+	return p.name
+}
+
+func (p *PlaylistView) Root() tview.Primitive {
+	return p.root
+}
+
+func (p *PlaylistView) SetupEvents() {
+	p.entries.SetSelectedFunc(func(idx int, _ string, _ string, _ rune) {
+		p.toggle(idx)
+	})
+
+	p.root.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyEscape, event.Rune() == 'q':
+			// a listing still running must not add the item once cancelled
+			p.item = nil
+			p.cancelAction()
+			return nil
+		case event.Rune() == ' ':
+			p.toggle(p.entries.GetCurrentItem())
+			return nil
+		case event.Rune() == 'a' && p.playlist != nil:
+			p.toggleAll()
+			return nil
+		case event.Rune() == 'c':
+			p.confirm()
+			return nil
+		case event.Rune() == 'j':
+			return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+		case event.Rune() == 'k':
+			return tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+		}
+		return event
+	})
+}
@@ -3,6 +3,7 @@ package ui
 import (
 	"sort"
 
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
 	"github.com/gdamore/tcell/v2"
 	"github.com/lithammer/fuzzysearch/fuzzy"
 	"github.com/rivo/tview"
@@ -15,6 +16,8 @@ type SearchView struct {
 	title   *tview.TextView
 	input   *tview.InputField
 	results *tview.List
+	// matches are the ids of the listed items, which may since have been removed
+	matches []string
 	active  bool
 }
 
@@ -47,6 +50,16 @@ func NewSearchView(app *App) *SearchView {
 	return searchView
 }
 
+// setResults lists the items by title
+func (s *SearchView) setResults(items []*url.UrlItem) {
+	s.matches = s.matches[:0]
+	s.results.Clear()
+	for _, item := range items {
+		s.matches = append(s.matches, item.ID())
+		s.results.AddItem(tview.Escape(item.Title()), "", 0, nil)
+	}
+}
+
 func (s *SearchView) IsActive() bool {
 	return s.active
 }
@@ -65,29 +78,34 @@ func (s *SearchView) Root() tview.Primitive {
 
 func (s *SearchView) SetupEvents() {
 	s.input.SetDoneFunc(func(key tcell.Key) {
-		s.results.Clear()
+		items := s.App.queue.Items()
 
-		var urls []string
-		for _, el := range s.App.urls {
-			urls = append(urls, el.Url)
+		var targets []string
+		for _, item := range items {
+			targets = append(targets, item.Title()+" "+item.Url)
 		}
 
-		results := fuzzy.RankFind(s.input.GetText(), urls)
+		results := fuzzy.RankFindFold(s.input.GetText(), targets)
 		sort.Sort(results)
 
-		for _, item := range results {
-			s.results.AddItem(item.Target, "", 0, nil)
+		matches := make([]*url.UrlItem, 0, len(results))
+		for _, result := range results {
+			matches = append(matches, items[result.OriginalIndex])
 		}
+		s.setResults(matches)
 		s.App.SetFocus(s.results)
 	})
 
-	s.results.SetSelectedFunc(func(_ int, result string, _ string, _ rune) {
-		if s.results.GetItemCount() == 0 {
+	s.results.SetSelectedFunc(func(idx int, _ string, _ string, _ rune) {
+		if idx < 0 || idx >= len(s.matches) {
 			return
 		}
 		mainview := s.App.views["MainView"].(*MainView)
-		idxs := mainview.urlsList.FindItems(result, "", false, true)
-		mainview.urlsList.SetCurrentItem(idxs[0])
+		if item := s.App.queue.Get(s.matches[idx]); item != nil {
+			if row := mainview.rowOf(item); row >= 0 {
+				mainview.urlsList.SetCurrentItem(row)
+			}
+		}
 		s.App.SwitchToPage("MainView")
 	})
 
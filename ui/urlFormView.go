@@ -1,39 +1,246 @@
 package ui
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blckfalcon/go-ytdlp-mngr/internal/config"
 	"github.com/blckfalcon/go-ytdlp-mngr/internal/url"
 	"github.com/rivo/tview"
 )
 
+// simulateDelay is how long the url must stay unchanged before it is
+// checked with yt-dlp
+const simulateDelay = 500 * time.Millisecond
+
 type UrlFormView struct {
-	App    *App
-	name   string
-	root   *tview.Form
-	active bool
+	App     *App
+	name    string
+	root    *tview.Form
+	message *tview.TextView
+	active  bool
+	// simulate checks that yt-dlp can download a url, nil to skip the check
+	simulate   func(rawUrl string) error
+	checkSeq   int
+	checkTimer *time.Timer
 }
 
 func NewUrlFormView(app *App) *UrlFormView {
 	urlFormView := &UrlFormView{
-		App:    app,
-		name:   "UrlFormView",
-		root:   tview.NewForm(),
-		active: false,
+		App:     app,
+		name:    "UrlFormView",
+		root:    tview.NewForm(),
+		message: tview.NewTextView(),
+		active:  false,
 	}
 
 	urlFormView.root.SetBorder(true)
+	urlFormView.message.SetDynamicColors(true).SetSize(2, 0)
 
 	return urlFormView
 }
 
-func (u *UrlFormView) contructForm(item *url.UrlItem, okAction func(), cancelAction func()) {
+func (u *UrlFormView) contructForm(item *url.UrlItem, profiles []config.Profile, okAction func(), formatAction func(), bulkAction func(), cancelAction func()) {
 	u.root.Clear(true)
 
 	u.root.AddInputField("Url", "", 256, nil, func(url string) {
 		item.Url = url
+		u.validate(url)
 	})
 
+	if len(profiles) > 0 {
+		names := make([]string, 0, len(profiles))
+		for _, profile := range profiles {
+			names = append(names, profile.Name)
+		}
+
+		u.root.AddDropDown("Profile", names, 0, func(_ string, idx int) {
+			if idx >= 0 {
+				item.Profile = profiles[idx]
+			}
+		})
+	}
+
+	u.message.SetText("")
+	u.root.AddFormItem(u.message)
+
 	u.root.AddButton("Save", func() { okAction() })
+	u.root.AddButton("Pick format", func() { formatAction() })
+	u.root.AddButton("Many urls", func() { bulkAction() })
+	u.root.AddButton("Cancel", func() { cancelAction() })
+
+	u.validate(item.Url)
+}
+
+// contructBulkForm shows a text area taking one url per line, in the format
+// of a yt-dlp batch file. A file can be loaded into it before adding them.
+func (u *UrlFormView) contructBulkForm(profiles []config.Profile, addAction func(text string, profile config.Profile), cancelAction func()) {
+	u.root.Clear(true)
+	u.checkSeq++
+	if u.checkTimer != nil {
+		u.checkTimer.Stop()
+	}
+
+	var selected config.Profile
+	if len(profiles) > 0 {
+		selected = profiles[0]
+	}
+
+	urls := tview.NewTextArea().
+		SetLabel("Urls").
+		SetSize(10, 0).
+		SetPlaceholder("One url per line, lines starting with # are ignored")
+	urls.SetChangedFunc(func() {
+		u.validateBulk(urls.GetText())
+	})
+	u.root.AddFormItem(urls)
+
+	u.root.AddInputField("Import file", "", 256, nil, nil)
+
+	if len(profiles) > 0 {
+		names := make([]string, 0, len(profiles))
+		for _, profile := range profiles {
+			names = append(names, profile.Name)
+		}
+
+		u.root.AddDropDown("Profile", names, 0, func(_ string, idx int) {
+			if idx >= 0 {
+				selected = profiles[idx]
+			}
+		})
+	}
+
+	u.message.SetText("")
+	u.root.AddFormItem(u.message)
+
+	u.root.AddButton("Add all", func() { addAction(urls.GetText(), selected) })
+	u.root.AddButton("Load file", func() {
+		path := u.root.GetFormItemByLabel("Import file").(*tview.InputField).GetText()
+		text, err := loadBatchFile(path)
+		if err != nil {
+			u.setMessage("[red]" + tview.Escape(err.Error()))
+			return
+		}
+		if current := strings.TrimRight(urls.GetText(), "\n"); current != "" {
+			text = current + "\n" + text
+		}
+		urls.SetText(text, true)
+	})
 	u.root.AddButton("Cancel", func() { cancelAction() })
+
+	u.validateBulk("")
+}
+
+// loadBatchFile returns the urls listed in the batch file at path, one per line
+func loadBatchFile(path string) (string, error) {
+	path, err := config.ExpandHome(strings.TrimSpace(path))
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", errors.New("no file to import")
+	}
+
+	entries, err := url.ReadBatchFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lines = append(lines, entry.Url)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// validateBulk counts the urls of text and reports the invalid ones, Add all
+// stays disabled until there is a valid url
+func (u *UrlFormView) validateBulk(text string) {
+	entries, _ := url.ParseBatch(strings.NewReader(text))
+
+	var invalid []string
+	for _, entry := range entries {
+		if err := url.Validate(entry.Url); err != nil {
+			invalid = append(invalid, fmt.Sprintf("line %d: %v", entry.Line, err))
+		}
+	}
+
+	valid := len(entries) - len(invalid)
+	if idx := u.root.GetButtonIndex("Add all"); idx >= 0 {
+		u.root.GetButton(idx).SetDisabled(valid == 0)
+	}
+
+	switch {
+	case len(entries) == 0:
+		u.setMessage("")
+	case len(invalid) == 0:
+		u.setMessage(fmt.Sprintf("[green]%d urls", valid))
+	default:
+		u.setMessage(fmt.Sprintf(
+			"[blue]%d urls [red]%d invalid, %s",
+			valid, len(invalid), tview.Escape(strings.Join(invalid, ", ")),
+		))
+	}
+}
+
+// validate checks the url as it is typed, Save and Pick format stay disabled
+// until it is valid and, when enabled, yt-dlp accepted it
+func (u *UrlFormView) validate(rawUrl string) {
+	u.checkSeq++
+	if u.checkTimer != nil {
+		u.checkTimer.Stop()
+	}
+
+	if err := url.Validate(rawUrl); err != nil {
+		if errors.Is(err, url.ErrEmptyUrl) {
+			u.setMessage("")
+		} else {
+			u.setMessage("[red]" + tview.Escape(err.Error()))
+		}
+		u.setValid(false)
+		return
+	}
+
+	if u.simulate == nil {
+		u.setMessage("")
+		u.setValid(true)
+		return
+	}
+
+	u.setMessage("[grey]Checking with yt-dlp...")
+	u.setValid(false)
+
+	seq := u.checkSeq
+	u.checkTimer = time.AfterFunc(simulateDelay, func() {
+		err := u.simulate(rawUrl)
+		u.App.QueueUpdateDraw(func() {
+			if seq != u.checkSeq {
+				return
+			}
+			if err != nil {
+				u.setMessage("[red]" + tview.Escape(err.Error()))
+				return
+			}
+			u.setMessage("[green]yt-dlp can download this url")
+			u.setValid(true)
+		})
+	})
+}
+
+// setValid enables the buttons acting on the url
+func (u *UrlFormView) setValid(valid bool) {
+	for _, label := range []string{"Save", "Pick format"} {
+		if idx := u.root.GetButtonIndex(label); idx >= 0 {
+			u.root.GetButton(idx).SetDisabled(!valid)
+		}
+	}
+}
+
+// setMessage shows a warning or an error below the form fields
+func (u *UrlFormView) setMessage(msg string) {
+	u.message.SetText(msg)
 }
 
 func (u *UrlFormView) IsActive() bool {